@@ -0,0 +1,132 @@
+package main
+
+import (
+	"GO/server/filters"
+	"GO/shared"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// comparerConversion compare l'ancienne représentation des pixels (une matrice [][][4]uint8, remplie pixel par pixel avec At
+// et relue avec Set) au tampon RGBA continu utilisé désormais par les filtres, pour chacun des types d'images produits par les décodeurs
+func comparerConversion(largeur, hauteur, repetitions int) {
+	fmt.Printf("Images de %dx%d (%.1f mégapixels), meilleur temps sur %d mesures, filtre %s\n\n",
+		largeur, hauteur, float64(largeur*hauteur)/1e6, repetitions, shared.FilterGrayscale)
+	fmt.Printf("%-10s %15s %15s %10s %12s %12s %6s\n", "type", "matrice", "tampon", "gain", "mémoire av.", "mémoire ap.", "écart")
+
+	pipeline := shared.Pipeline{{Name: shared.FilterGrayscale}}
+	for _, cas := range imagesDeTest(largeur, hauteur) {
+		ancien, memAncien := mesurer(repetitions, func() {
+			ancienGris(cas.img)
+		})
+		nouveau, memNouveau := mesurer(repetitions, func() {
+			if _, err := filters.ApplyPipeline(pipeline, cas.img); err != nil {
+				panic(err)
+			}
+		})
+
+		// On vérifie au passage que les deux méthodes donnent la même image (à un arrondi près pour le YCbCr)
+		resultat, _ := filters.ApplyPipeline(pipeline, cas.img)
+		fmt.Printf("%-10s %15v %15v %9.1fx %9d Mo %9d Mo %6d\n", cas.nom, ancien, nouveau,
+			float64(ancien)/float64(nouveau), memAncien>>20, memNouveau>>20, ecartMax(ancienGris(cas.img), resultat))
+	}
+}
+
+// imageDeTest associe une image synthétique au nom de son type
+type imageDeTest struct {
+	nom string
+	img image.Image
+}
+
+// imagesDeTest génère un dégradé dans chacun des types d'images renvoyés par les décodeurs jpeg, png et gif
+func imagesDeTest(largeur, hauteur int) []imageDeTest {
+	rect := image.Rect(0, 0, largeur, hauteur)
+	rgba := image.NewRGBA(rect)
+	nrgba := image.NewNRGBA(rect)
+	gray := image.NewGray(rect)
+	ycbcr := image.NewYCbCr(rect, image.YCbCrSubsampleRatio420)
+	paletted := image.NewPaletted(rect, palette())
+
+	for y := 0; y < hauteur; y++ {
+		for x := 0; x < largeur; x++ {
+			c := color.NRGBA{R: uint8(x), G: uint8(y), B: uint8(x + y), A: 255}
+			rgba.Set(x, y, c)
+			nrgba.Set(x, y, c)
+			gray.Set(x, y, c)
+			paletted.SetColorIndex(x, y, uint8(x^y))
+
+			yy, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+			ycbcr.Y[ycbcr.YOffset(x, y)] = yy
+			ycbcr.Cb[ycbcr.COffset(x, y)] = cb
+			ycbcr.Cr[ycbcr.COffset(x, y)] = cr
+		}
+	}
+
+	return []imageDeTest{
+		{"YCbCr", ycbcr},
+		{"RGBA", rgba},
+		{"NRGBA", nrgba},
+		{"Gray", gray},
+		{"Paletted", paletted},
+	}
+}
+
+// palette construit une palette de 256 couleurs, comme celle d'un gif
+func palette() color.Palette {
+	p := make(color.Palette, 256)
+	for i := range p {
+		p[i] = color.RGBA{R: uint8(i), G: uint8(255 - i), B: uint8(i * 7), A: 255}
+	}
+	return p
+}
+
+// ancienGris reproduit le traitement d'origine du filtre niveaux de gris : conversion de l'image en matrice de pixels
+// avec At, application du filtre, puis reconversion en image avec Set
+func ancienGris(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	matrix := make([][][4]uint8, height)
+	for y := 0; y < height; y++ {
+		matrix[y] = make([][4]uint8, width)
+		for x := 0; x < width; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			matrix[y][x] = [4]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+		}
+	}
+
+	output := make([][][4]uint8, height)
+	for y := 0; y < height; y++ {
+		output[y] = make([][4]uint8, width)
+		for x := 0; x < width; x++ {
+			pixel := matrix[y][x]
+			gray := uint8(0.299*float64(pixel[0]) + 0.587*float64(pixel[1]) + 0.114*float64(pixel[2]))
+			output[y][x] = [4]uint8{gray, gray, gray, pixel[3]}
+		}
+	}
+
+	result := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			pixel := output[y][x]
+			result.Set(x, y, color.RGBA{R: pixel[0], G: pixel[1], B: pixel[2], A: pixel[3]})
+		}
+	}
+	return result
+}
+
+// ecartMax renvoie la plus grande différence entre deux canaux correspondants de deux images de même taille
+func ecartMax(a, b *image.RGBA) int {
+	var ecart int
+	for i := range a.Pix {
+		d := int(a.Pix[i]) - int(b.Pix[i])
+		if d < 0 {
+			d = -d
+		}
+		if d > ecart {
+			ecart = d
+		}
+	}
+	return ecart
+}
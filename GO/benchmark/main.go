@@ -0,0 +1,290 @@
+package main
+
+import (
+	"GO/server/filters"
+	"GO/shared"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Programme de mesure des performances du package filters.
+//
+// Par défaut, il applique chaque filtre à des images synthétiques de plusieurs tailles, d'abord séquentiellement puis
+// avec des pools de 1, 2, 4... goroutines (en bandes de lignes puis en tuiles), et écrit un rapport (CSV ou JSON) donnant
+// pour chaque mesure l'accélération par rapport à la version séquentielle et l'efficacité (l'accélération divisée par
+// le nombre de goroutines).
+//
+// Avec -conversion, il compare plutôt l'ancienne représentation des pixels au tampon RGBA continu utilisé par les filtres.
+
+// mesure est une ligne du rapport : le meilleur temps d'un filtre sur une taille d'image, avec une stratégie donnée
+type mesure struct {
+	Filtre       string  `json:"filtre"`
+	Largeur      int     `json:"largeur"`
+	Hauteur      int     `json:"hauteur"`
+	Megapixels   float64 `json:"megapixels"`
+	Strategie    string  `json:"strategie"` // "sequentielle", "lignes" ou "tuiles"
+	Workers      int     `json:"workers"`   // Nombre de goroutines du pool (1 pour la version séquentielle)
+	DureeMs      float64 `json:"duree_ms"`
+	Acceleration float64 `json:"acceleration"` // Durée séquentielle divisée par cette durée
+	Efficacite   float64 `json:"efficacite"`   // Accélération divisée par le nombre de goroutines
+}
+
+// rapport regroupe les mesures et la description de la machine qui les a faites
+type rapport struct {
+	Date        time.Time `json:"date"`
+	VersionGo   string    `json:"version_go"`
+	CPUs        int       `json:"cpus"`
+	GOMAXPROCS  int       `json:"gomaxprocs"`
+	Repetitions int       `json:"repetitions"`
+	Mesures     []mesure  `json:"mesures"`
+}
+
+func main() {
+	tailles := flag.String("tailles", "640x480,1920x1080,6000x4000", "tailles des images de test, séparées par des virgules")
+	workers := flag.String("workers", listeWorkers(), "nombres de goroutines à essayer, séparés par des virgules")
+	listeFiltres := flag.String("filtres", "gris+contours+nettete+flou:rayon=10+flou_boite:rayon=10", "filtres à mesurer, séparés par des + (chacun est mesuré seul)")
+	repetitions := flag.Int("repetitions", 3, "nombre de mesures par cas (on garde la meilleure)")
+	format := flag.String("format", "csv", "format du rapport : csv ou json")
+	sortie := flag.String("sortie", "", "fichier où écrire le rapport (la sortie standard par défaut)")
+	conversion := flag.Bool("conversion", false, "comparer la matrice de pixels d'origine au tampon RGBA, au lieu de mesurer les filtres")
+	flag.Parse()
+
+	dimensions, err := lireTailles(*tailles)
+	if err != nil {
+		fmt.Println("Paramètres invalides :", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *repetitions < 1 {
+		fmt.Println("Paramètres invalides : -repetitions doit être au moins 1, reçu", *repetitions)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *conversion {
+		for _, d := range dimensions {
+			comparerConversion(d.X, d.Y, *repetitions)
+			fmt.Println()
+		}
+		return
+	}
+
+	nbWorkers, err := lireEntiers(*workers)
+	if err != nil {
+		fmt.Println("Paramètres invalides :", err)
+		os.Exit(2)
+	}
+	pipeline, err := shared.ParsePipeline(*listeFiltres)
+	if err != nil {
+		fmt.Println("Filtres invalides :", err)
+		os.Exit(2)
+	}
+	if *format != "csv" && *format != "json" {
+		fmt.Println("Format de rapport inconnu :", *format)
+		os.Exit(2)
+	}
+
+	r := rapport{
+		Date:        time.Now(),
+		VersionGo:   runtime.Version(),
+		CPUs:        runtime.NumCPU(),
+		GOMAXPROCS:  runtime.GOMAXPROCS(0),
+		Repetitions: *repetitions,
+	}
+	for _, d := range dimensions {
+		img := imageSynthetique(d.X, d.Y)
+		for _, filter := range pipeline {
+			mesures, err := mesurerFiltre(filter, img, nbWorkers, *repetitions)
+			if err != nil {
+				fmt.Printf("Erreur avec le filtre %s : %v\n", filter, err)
+				os.Exit(1)
+			}
+			r.Mesures = append(r.Mesures, mesures...)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *sortie != "" {
+		f, err := os.Create(*sortie)
+		if err != nil {
+			fmt.Println("Erreur lors de la création du rapport :", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "json" {
+		err = ecrireJSON(w, r)
+	} else {
+		err = ecrireCSV(w, r)
+	}
+	if err != nil {
+		fmt.Println("Erreur lors de l'écriture du rapport :", err)
+		os.Exit(1)
+	}
+}
+
+// mesurerFiltre mesure un filtre sur une image, séquentiellement puis avec chacun des nombres de goroutines demandés,
+// en bandes de lignes et en tuiles (les messages de progression vont sur la sortie d'erreur, pour ne pas se mélanger au rapport)
+func mesurerFiltre(filter shared.Filter, img *image.RGBA, nbWorkers []int, repetitions int) ([]mesure, error) {
+	pipeline := shared.Pipeline{filter}
+	base := mesure{
+		Filtre:     filter.String(),
+		Largeur:    img.Rect.Dx(),
+		Hauteur:    img.Rect.Dy(),
+		Megapixels: float64(img.Rect.Dx()*img.Rect.Dy()) / 1e6,
+	}
+
+	var errFiltre error
+	appliquer := func(strategy shared.Strategy, pool *filters.WorkerPool) func() {
+		return func() {
+			if _, err := filters.ApplyPipelineWith(context.Background(), pipeline, img, strategy, pool); err != nil {
+				errFiltre = err
+			}
+		}
+	}
+
+	sequentiel, _ := mesurer(repetitions, appliquer(shared.StrategySequential, nil))
+	if errFiltre != nil {
+		return nil, errFiltre
+	}
+	m := base
+	m.Strategie, m.Workers = string(shared.StrategySequential), 1
+	m.DureeMs, m.Acceleration, m.Efficacite = millisecondes(sequentiel), 1, 1
+	mesures := []mesure{m}
+	fmt.Fprintf(os.Stderr, "%s %dx%d séquentielle : %v\n", base.Filtre, base.Largeur, base.Hauteur, sequentiel)
+
+	for _, n := range nbWorkers {
+		pool := filters.NewWorkerPool(n)
+		for _, strategy := range []shared.Strategy{shared.StrategyRows, shared.StrategyTiles} {
+			duree, _ := mesurer(repetitions, appliquer(strategy, pool))
+
+			m := base
+			m.Strategie, m.Workers = string(strategy), n
+			m.DureeMs = millisecondes(duree)
+			m.Acceleration = float64(sequentiel) / float64(duree)
+			m.Efficacite = m.Acceleration / float64(n)
+			mesures = append(mesures, m)
+			fmt.Fprintf(os.Stderr, "%s %dx%d %s, %d goroutines : %v (x%.2f)\n", base.Filtre, base.Largeur, base.Hauteur, strategy, n, duree, m.Acceleration)
+		}
+		pool.Close()
+	}
+	return mesures, nil
+}
+
+// mesurer exécute f plusieurs fois, et renvoie la meilleure durée et la mémoire allouée par une exécution
+func mesurer(repetitions int, f func()) (time.Duration, uint64) {
+	var meilleur time.Duration
+	var memoire uint64
+	for i := 0; i < repetitions; i++ {
+		runtime.GC()
+		var avant, apres runtime.MemStats
+		runtime.ReadMemStats(&avant)
+
+		debut := time.Now()
+		f()
+		duree := time.Since(debut)
+
+		runtime.ReadMemStats(&apres)
+		memoire = apres.TotalAlloc - avant.TotalAlloc
+		if i == 0 || duree < meilleur {
+			meilleur = duree
+		}
+	}
+	return meilleur, memoire
+}
+
+// ecrireCSV écrit les mesures du rapport, une par ligne, précédées d'une ligne d'en-tête
+func ecrireCSV(w io.Writer, r rapport) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"filtre", "largeur", "hauteur", "megapixels", "strategie", "workers", "duree_ms", "acceleration", "efficacite"})
+	for _, m := range r.Mesures {
+		cw.Write([]string{
+			m.Filtre,
+			strconv.Itoa(m.Largeur),
+			strconv.Itoa(m.Hauteur),
+			strconv.FormatFloat(m.Megapixels, 'f', 2, 64),
+			m.Strategie,
+			strconv.Itoa(m.Workers),
+			strconv.FormatFloat(m.DureeMs, 'f', 3, 64),
+			strconv.FormatFloat(m.Acceleration, 'f', 3, 64),
+			strconv.FormatFloat(m.Efficacite, 'f', 3, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ecrireJSON écrit le rapport complet, avec la description de la machine
+func ecrireJSON(w io.Writer, r rapport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// imageSynthetique génère une image RGBA avec des dégradés et des motifs, pour que les filtres aient de quoi travailler
+func imageSynthetique(largeur, hauteur int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, largeur, hauteur))
+	for y := 0; y < hauteur; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+4*largeur]
+		for x := 0; x < largeur; x++ {
+			row[4*x] = uint8(x)
+			row[4*x+1] = uint8(y)
+			row[4*x+2] = uint8((x / 16) ^ (y / 16))
+			row[4*x+3] = 255
+		}
+	}
+	return img
+}
+
+// lireTailles lit une liste de tailles de la forme "640x480,1920x1080"
+func lireTailles(s string) ([]image.Point, error) {
+	var tailles []image.Point
+	for _, t := range strings.Split(s, ",") {
+		l, h, ok := strings.Cut(strings.TrimSpace(t), "x")
+		largeur, errL := strconv.Atoi(l)
+		hauteur, errH := strconv.Atoi(h)
+		if !ok || errL != nil || errH != nil || largeur < 1 || hauteur < 1 {
+			return nil, fmt.Errorf("taille invalide : %q (attendu <largeur>x<hauteur>)", t)
+		}
+		tailles = append(tailles, image.Pt(largeur, hauteur))
+	}
+	return tailles, nil
+}
+
+// lireEntiers lit une liste d'entiers strictement positifs séparés par des virgules
+func lireEntiers(s string) ([]int, error) {
+	var entiers []int
+	for _, e := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(e))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("nombre de goroutines invalide : %q", e)
+		}
+		entiers = append(entiers, n)
+	}
+	return entiers, nil
+}
+
+// listeWorkers renvoie la liste par défaut des nombres de goroutines à essayer : les puissances de 2 jusqu'à GOMAXPROCS, puis GOMAXPROCS
+func listeWorkers() string {
+	max := runtime.GOMAXPROCS(0)
+	var liste []string
+	for n := 1; n < max; n *= 2 {
+		liste = append(liste, strconv.Itoa(n))
+	}
+	return strings.Join(append(liste, strconv.Itoa(max)), ",")
+}
+
+// millisecondes convertit une durée en millisecondes, avec les décimales
+func millisecondes(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
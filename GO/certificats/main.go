@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Programme de génération de certificats auto-signés, pour essayer TLS et TLS mutuel entre le serveur et les clients.
+//
+// Il crée une autorité de certification, puis un certificat pour le serveur et un pour un client, signés par cette autorité :
+//
+//	ca.pem                          certificat de l'autorité (-tls-ca des clients, -tls-ca-clients du serveur)
+//	serveur.pem, serveur-cle.pem    certificat et clé du serveur (-tls-cert et -tls-cle du serveur)
+//	client.pem, client-cle.pem      certificat et clé du client (-tls-cert et -tls-cle des clients)
+//
+// La clé de l'autorité (ca-cle.pem) est aussi écrite ; ces certificats ne conviennent qu'aux essais.
+
+func main() {
+	dossier := flag.String("dossier", "certificats", "dossier où écrire les certificats et les clés")
+	hotes := flag.String("hotes", "localhost,127.0.0.1,::1", "noms et adresses IP du serveur, séparés par des virgules")
+	client := flag.String("client", "client", "nom du client, inscrit dans son certificat et affiché par le serveur")
+	validite := flag.Duration("validite", 365*24*time.Hour, "durée de validité des certificats")
+	flag.Parse()
+
+	if err := os.MkdirAll(*dossier, 0755); err != nil {
+		fmt.Println("Erreur lors de la création du dossier :", err)
+		os.Exit(1)
+	}
+
+	// L'autorité de certification se signe elle-même
+	ca := modele("Autorité de test des filtres", *validite)
+	ca.IsCA = true
+	ca.BasicConstraintsValid = true
+	ca.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	caCert, caCle, err := generer(ca, nil, nil, *dossier, "ca")
+	if err != nil {
+		fmt.Println("Erreur lors de la création de l'autorité :", err)
+		os.Exit(1)
+	}
+
+	serveur := modele("Serveur de filtres", *validite)
+	serveur.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, h := range strings.Split(*hotes, ",") {
+		h = strings.TrimSpace(h)
+		if ip := net.ParseIP(h); ip != nil {
+			serveur.IPAddresses = append(serveur.IPAddresses, ip)
+		} else if h != "" {
+			serveur.DNSNames = append(serveur.DNSNames, h)
+		}
+	}
+	if _, _, err := generer(serveur, caCert, caCle, *dossier, "serveur"); err != nil {
+		fmt.Println("Erreur lors de la création du certificat du serveur :", err)
+		os.Exit(1)
+	}
+
+	cl := modele(*client, *validite)
+	cl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	if _, _, err := generer(cl, caCert, caCle, *dossier, "client"); err != nil {
+		fmt.Println("Erreur lors de la création du certificat du client :", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Certificats écrits dans", *dossier)
+}
+
+// modele prépare un certificat valide dès maintenant, au nom donné
+func modele(nom string, validite time.Duration) *x509.Certificate {
+	serie, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	return &x509.Certificate{
+		SerialNumber: serie,
+		Subject:      pkix.Name{CommonName: nom},
+		NotBefore:    time.Now().Add(-time.Minute), // Un peu de marge si les horloges ne sont pas tout à fait à l'heure
+		NotAfter:     time.Now().Add(validite),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+}
+
+// generer crée une clé et le certificat correspondant, signé par parent (ou par lui-même si parent est nil),
+// et les écrit dans <nom>.pem et <nom>-cle.pem
+func generer(cert, parent *x509.Certificate, cleParent crypto.Signer, dossier, nom string) (*x509.Certificate, crypto.Signer, error) {
+	cle, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if parent == nil {
+		parent, cleParent = cert, cle
+	}
+	der, err := x509.CreateCertificate(rand.Reader, cert, parent, cle.Public(), cleParent)
+	if err != nil {
+		return nil, nil, err
+	}
+	cleDER, err := x509.MarshalPKCS8PrivateKey(cle)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := ecrirePEM(filepath.Join(dossier, nom+".pem"), "CERTIFICATE", der, 0644); err != nil {
+		return nil, nil, err
+	}
+	// La clé privée n'est lisible que par son propriétaire
+	if err := ecrirePEM(filepath.Join(dossier, nom+"-cle.pem"), "PRIVATE KEY", cleDER, 0600); err != nil {
+		return nil, nil, err
+	}
+	signe, err := x509.ParseCertificate(der)
+	return signe, cle, err
+}
+
+// ecrirePEM écrit un bloc PEM dans un fichier, avec les permissions données
+func ecrirePEM(chemin, typeBloc string, der []byte, permissions os.FileMode) error {
+	f, err := os.OpenFile(chemin, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, permissions)
+	if err != nil {
+		return err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: typeBloc, Bytes: der}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -3,32 +3,288 @@ package main
 import (
 	"GO/shared"
 	"bufio"
+	"crypto/tls"
 	"encoding/gob"
+	"flag"
 	"fmt"
-	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
-const adresse_server = "localhost:9000"
+const adresse_server = "localhost:9000" // Adresse du serveur quand l'option -server n'est pas donnée
+
+// codeErreurLocale est le code de sortie des erreurs locales (connexion, TLS, fichiers...) :
+// aucune catégorie d'erreur du serveur ne l'utilise, voir shared.ErrorCategory.ExitCode
+const codeErreurLocale = 1
 
 func init() {
 	gob.Register(shared.ImageData{})
+	gob.Register(shared.Response{})
 }
 
 func main() {
-	fmt.Print("Entrez le chemin du fichier image à envoyer : ")
+	os.Exit(lancer())
+}
+
+// lancer déroule la session avec l'utilisateur et renvoie le code de sortie du client : 0 si l'utilisateur a quitté normalement,
+// codeErreurLocale si la session a échoué de ce côté (connexion, TLS, fichiers...). Les erreurs renvoyées par le serveur
+// arrêtent le client avec le code propre à leur catégorie (voir shared.ErrorCategory.ExitCode)
+func lancer() int {
+	serveur := flag.String("server", adresse_server, "adresse du serveur : hôte:port, ou unix:///chemin pour une socket Unix")
+	jeton := flag.String("jeton", os.Getenv("FILTRES_JETON"), "jeton d'accès au serveur (variable FILTRES_JETON par défaut, pour ne pas le laisser dans l'historique du shell)")
+	tlsActif := flag.Bool("tls", false, "chiffrer la connexion avec TLS (implicite avec -tls-ca ou -tls-cert)")
+	tlsCA := flag.String("tls-ca", "", "fichier PEM des autorités qui ont signé le certificat du serveur (celles du système par défaut)")
+	tlsCert := flag.String("tls-cert", "", "certificat PEM présenté au serveur, quand il vérifie les certificats des clients")
+	tlsCle := flag.String("tls-cle", "", "clé privée PEM du certificat -tls-cert")
+	flag.Parse()
+
+	//connexion au serveur : la même connexion servira pour toutes les images de la session
+	var tlsConfig *tls.Config
+	if *tlsActif || *tlsCA != "" || *tlsCert != "" {
+		var err error
+		if tlsConfig, err = shared.ClientTLSConfig(*tlsCA, *tlsCert, *tlsCle); err != nil {
+			fmt.Println("Configuration TLS invalide :", err)
+			return codeErreurLocale
+		}
+	}
+	conn, err := shared.Dial(*serveur, tlsConfig)
+	if err != nil {
+		fmt.Println("Erreur lors de la connexion au serveur :", err)
+		return codeErreurLocale
+	}
+	defer conn.Close() //une fois tout le reste exécuté, on fermera la connexion
+
+	// Création d'un sous-répertoire pour ce client (évite de tous les mélanger et d'avoir des problèmes de noms de fichiers)
+	clientDir := filepath.Join("client_images", fmt.Sprintf("client_%d", time.Now().Unix()))
+	//on associe au client dans le nom du répertoire l'heure exacte où il est traité
+	if err := os.MkdirAll(clientDir, 0755); err != nil { // création du répertoire avec les permissions rwxr-xr-x (755)
+		fmt.Println("Erreur lors de la création du répertoire client :", err)
+		return codeErreurLocale
+	}
+
 	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Scan()
+	s := &session{encoder: gob.NewEncoder(conn), decoder: gob.NewDecoder(conn), clientDir: clientDir}
+	response, ok := s.authentifier(*jeton)
+	if !ok {
+		return codeErreurLocale
+	}
+	fmt.Println("Serveur :", response.Message)
+
+	code := 0
+	for { // Une demande par tour de boucle, jusqu'à ce que l'utilisateur souhaite arrêter
+		fmt.Println("Que voulez-vous faire ?")
+		fmt.Println("1 - Traiter une image et attendre le résultat")
+		fmt.Println("2 - Soumettre une image en arrière-plan (travail asynchrone)")
+		fmt.Println("3 - Consulter l'état d'un travail")
+		fmt.Println("4 - Récupérer le résultat d'un travail")
+		fmt.Println("5 - Quitter")
+		fmt.Print("Votre choix : ")
+		if !scanner.Scan() {
+			break
+		}
+
+		ok, quitter := true, false
+		switch strings.TrimSpace(scanner.Text()) {
+		case "1":
+			ok = s.traiterImage(scanner, false)
+		case "2":
+			ok = s.traiterImage(scanner, true)
+		case "3":
+			ok = s.consulterTravail(scanner, shared.ActionStatus)
+		case "4":
+			ok = s.consulterTravail(scanner, shared.ActionFetch)
+		case "5":
+			quitter = true
+		default:
+			fmt.Println("Choix invalide, veuillez entrer un chiffre entre 1 et 5.")
+			continue
+		}
+		if !ok {
+			code = codeErreurLocale
+		}
+		if !ok || quitter {
+			break
+		}
+	}
+
+	//On prévient le serveur que la session est terminée
+	if err := s.encoder.Encode(shared.ImageData{Close: true}); err != nil {
+		fmt.Println("Erreur lors de la fermeture de la session :", err)
+	}
+	return code
+}
+
+// session regroupe ce qui sert à échanger avec le serveur pendant toute la session
+type session struct {
+	encoder   *gob.Encoder
+	decoder   *gob.Decoder
+	clientDir string
+	requestID uint64 // Identifiant de la dernière requête envoyée
+}
+
+// authentifier ouvre la session en présentant le jeton d'accès au serveur, avant toute requête
+// si le serveur refuse le client, on affiche son message et on s'arrête avec le code propre à la catégorie d'erreur
+func (s *session) authentifier(jeton string) (shared.Response, bool) {
+	if err := s.encoder.Encode(shared.Authentication{Token: jeton}); err != nil {
+		fmt.Println("Erreur lors de l'authentification :", err)
+		return shared.Response{}, false
+	}
+	var response shared.Response
+	if err := s.decoder.Decode(&response); err != nil {
+		fmt.Println("Erreur lors de l'authentification :", err)
+		return shared.Response{}, false
+	}
+	if response.Status != shared.StatusOK {
+		fmt.Printf("Le serveur a refusé la connexion (%d, %s) : %s\n", response.Status, response.Category, response.Message)
+		os.Exit(response.Category.ExitCode())
+	}
+	return response, true
+}
+
+// envoyer transmet une requête au serveur et attend sa réponse
+// si le serveur n'a pas pu la traiter, on affiche son message et on quitte avec le code propre à la catégorie d'erreur
+func (s *session) envoyer(imgData shared.ImageData) (shared.Response, bool) {
+	s.requestID++
+	imgData.RequestID = s.requestID
+
+	//envoi des données encodées
+	if err := s.encoder.Encode(imgData); err != nil {
+		// Le serveur peut refuser une requête sans la lire jusqu'au bout (message trop volumineux) : si sa réponse
+		// est arrivée avant la fermeture de la connexion, elle explique mieux le problème que l'erreur d'envoi
+		var response shared.Response
+		if s.decoder.Decode(&response) == nil && response.Status != shared.StatusOK && response.Status != shared.StatusAccepted {
+			fmt.Printf("Le serveur n'a pas pu traiter la demande (%d, %s) : %s\n", response.Status, response.Category, response.Message)
+			os.Exit(response.Category.ExitCode())
+		}
+		fmt.Println("Erreur lors de l'envoi de la requête :", err)
+		return shared.Response{}, false
+	}
+
+	//On décode la réponse du serveur qui est reçue par la connexion
+	var response shared.Response
+	if err := s.decoder.Decode(&response); err != nil {
+		fmt.Println("Erreur lors de la réception de la réponse :", err)
+		return shared.Response{}, false
+	}
+	if response.Status != shared.StatusOK && response.Status != shared.StatusAccepted {
+		fmt.Printf("Le serveur n'a pas pu traiter la demande (%d, %s) : %s\n", response.Status, response.Category, response.Message)
+		s.encoder.Encode(shared.ImageData{Close: true})
+		os.Exit(response.Category.ExitCode())
+	}
+	return response, true
+}
+
+// traiterImage demande à l'utilisateur une image et les filtres à lui appliquer, puis l'envoie au serveur :
+// soit pour un traitement immédiat dont on enregistre le résultat, soit comme travail asynchrone dont on affiche l'identifiant
+// elle renvoie false si la session ne peut pas continuer (connexion perdue, entrée standard fermée...)
+func (s *session) traiterImage(scanner *bufio.Scanner, async bool) bool {
+	fmt.Print("Entrez le chemin du fichier image à envoyer : ")
+	if !scanner.Scan() {
+		return false
+	}
 	imagePath := scanner.Text()
 
 	fileData, err := os.ReadFile(imagePath)
 	if err != nil {
 		fmt.Println("Erreur lors de la lecture du fichier :", err)
-		return
+		return true // On laisse l'utilisateur choisir une autre image
+	}
+
+	//On construit la liste des filtres à appliquer, l'un après l'autre, sur l'image
+	var pipeline shared.Pipeline
+	for len(pipeline) < shared.MaxPipelineLength {
+		filter, ok := choisirFiltre(scanner)
+		if !ok {
+			return false
+		}
+		pipeline = append(pipeline, filter)
+
+		fmt.Print("Ajouter un autre filtre à la suite ? (o/n) : ")
+		if !scanner.Scan() {
+			return false
+		}
+		if strings.ToLower(strings.TrimSpace(scanner.Text())) != "o" {
+			break
+		}
+	}
+
+	fmt.Printf("Format de l'image traitée (%s, Entrée pour garder celui de l'image) : ", strings.Join(shared.ImageFormats, ", "))
+	if !scanner.Scan() {
+		return false
+	}
+
+	//On prépare les données image pour l'envoi après encodage
+	imgData := shared.ImageData{
+		Name:         filepath.Base(imagePath), // Pour utiliser uniquement le nom du fichier même si on a un chemin complet
+		Data:         fileData,
+		Pipeline:     pipeline,
+		OutputFormat: strings.TrimSpace(scanner.Text()),
+	}
+	if async {
+		imgData.Action = shared.ActionSubmit
+	}
+
+	response, ok := s.envoyer(imgData)
+	if !ok {
+		return false
+	}
+	if async {
+		fmt.Printf("Travail soumis, identifiant : %s (%s)\n", response.JobID, response.JobState)
+		fmt.Println("Conservez cet identifiant pour récupérer le résultat plus tard, même depuis un autre client.")
+		return true
+	}
+	return s.sauvegarder(response.Image)
+}
+
+// consulterTravail demande l'identifiant d'un travail, puis affiche son état ou récupère son résultat selon l'action
+func (s *session) consulterTravail(scanner *bufio.Scanner, action shared.Action) bool {
+	fmt.Print("Entrez l'identifiant du travail : ")
+	if !scanner.Scan() {
+		return false
 	}
+	imgData := shared.ImageData{Action: action, JobID: strings.TrimSpace(scanner.Text())}
+
+	if action == shared.ActionFetch {
+		fmt.Print("Attendre la fin du travail s'il n'est pas terminé ? (o/n) : ")
+		if !scanner.Scan() {
+			return false
+		}
+		imgData.Wait = strings.ToLower(strings.TrimSpace(scanner.Text())) == "o"
+	}
+
+	response, ok := s.envoyer(imgData)
+	if !ok {
+		return false
+	}
+	if action == shared.ActionStatus || response.Status == shared.StatusAccepted {
+		fmt.Printf("Travail %s : %s\n", response.JobID, response.JobState)
+		if response.JobState == shared.JobFailed {
+			fmt.Println("Raison de l'échec :", response.Message)
+		}
+		return true
+	}
+	return s.sauvegarder(response.Image)
+}
+
+// sauvegarder enregistre l'image traitée reçue dans le répertoire propre à ce client
+// (préfixée par l'identifiant de la requête pour ne pas écraser une image de même nom traitée plus tôt dans la session)
+func (s *session) sauvegarder(processedImgData shared.ImageData) bool {
+	outputPath := filepath.Join(s.clientDir, fmt.Sprintf("modifiee_%d_%s", s.requestID, processedImgData.Name))
+	if err := os.WriteFile(outputPath, processedImgData.Data, 0644); err != nil {
+		fmt.Println("Erreur lors de la sauvegarde de l'image traitée :", err)
+		return false
+	}
+
+	fmt.Println("Image traitée sauvegardée sous :", outputPath)
+	return true
+}
 
+// choisirFiltre demande à l'utilisateur un filtre puis ses paramètres
+// elle renvoie false si l'entrée standard est fermée
+func choisirFiltre(scanner *bufio.Scanner) (shared.Filter, bool) {
 	var filterType int
 	for { // Boucle jusqu'à obtenir un choix valide
 		fmt.Println("Entrez le numéro correspondant au filtre de votre choix parmi les suivants :")
@@ -36,9 +292,13 @@ func main() {
 		fmt.Println("2 - Détection de contours")
 		fmt.Println("3 - Netteté")
 		fmt.Println("4 - Flou gaussien")
+		fmt.Println("5 - Noyau de convolution personnalisé")
+		fmt.Println("6 - Flou moyen (rapide, même pour un grand rayon)")
 		fmt.Print("Votre choix : ")
 
-		scanner.Scan()
+		if !scanner.Scan() {
+			return shared.Filter{}, false
+		}
 		filterChoice := scanner.Text()
 
 		switch filterChoice {
@@ -50,57 +310,78 @@ func main() {
 			filterType = 3
 		case "4":
 			filterType = 4
+		case "5":
+			kernel, ok := demanderNoyau(scanner)
+			if !ok {
+				return shared.Filter{}, false
+			}
+			return demanderParametres(scanner, shared.Filter{Name: shared.FilterCustomKernel, Kernel: kernel})
+		case "6":
+			return demanderParametres(scanner, shared.Filter{Name: shared.FilterBoxBlur})
 		default:
-			fmt.Println("Choix invalide, veuillez entrer un chiffre entre 1 et 4.")
+			fmt.Println("Choix invalide, veuillez entrer un chiffre entre 1 et 6.")
 			continue // On redemande le choix sans sortir de la boucle
 		}
 		break // Sortie de la boucle si le choix est valide
 	}
 
-	//connexion au serveur
-	conn, err := net.Dial("tcp", adresse_server)
-	if err != nil {
-		fmt.Println("Erreur lors de la connexion au serveur :", err)
-		return
-	}
-	defer conn.Close() //une fois tout le reste exécuté, on fermera la connexion
-
-	//On prépare les données image pour l'envoi après encodage
-	imgData := shared.ImageData{
-		Name:       filepath.Base(imagePath), // Pour utiliser uniquement le nom du fichier même si on a un chemin complet
-		Data:       fileData,
-		FilterType: filterType,
-	}
-
-	//envoi des données image encodées
-	encoder := gob.NewEncoder(conn)
-	if err := encoder.Encode(imgData); err != nil {
-		fmt.Println("Erreur lors de l'envoi de l'image :", err)
-		return
-	}
-
-	//On décode l'image traitée par le serveur qui est reçue par la connexion
-	var processedImgData shared.ImageData
-	decoder := gob.NewDecoder(conn)
-	if err := decoder.Decode(&processedImgData); err != nil {
-		fmt.Println("Erreur lors de la réception de l'image traitée :", err)
-		return
-	}
+	return demanderParametres(scanner, shared.FilterFromType(filterType))
+}
 
-	// Création d'un sous-répertoire pour ce client (évite de tous les mélanger et d'avoir des problèmes de noms de fichiers)
-	clientDir := filepath.Join("client_images", fmt.Sprintf("client_%d", time.Now().Unix()))
-	//on associe au client dans le nom du répertoire l'heure exacte où il est traité
-	if err := os.MkdirAll(clientDir, 0755); err != nil { // création du répertoire avec les permissions rwxr-xr-x (755)
-		fmt.Println("Erreur lors de la création du répertoire client :", err)
-		return
+// demanderNoyau fait saisir un noyau de convolution ligne par ligne, jusqu'à une ligne vide
+// le serveur vérifie ensuite que le noyau est carré et de taille impaire
+func demanderNoyau(scanner *bufio.Scanner) ([][]float64, bool) {
+	fmt.Printf("Entrez le noyau ligne par ligne (valeurs séparées par des espaces, plusieurs lignes possibles sur une seule en les séparant par des \"/\", carré de taille impaire jusqu'à %d), puis une ligne vide :\n", shared.MaxKernelSize)
+	var kernel [][]float64
+	for {
+		if !scanner.Scan() {
+			return nil, false
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			if len(kernel) == 0 {
+				continue // On attend au moins une ligne
+			}
+			return kernel, true
+		}
+		// Une ligne peut aussi contenir plusieurs lignes du noyau séparées par des "/", comme pour le client sans IHM
+		rows, err := shared.ParseKernel(line)
+		if err != nil {
+			fmt.Println("Ligne invalide, veuillez la ressaisir :", err)
+			continue
+		}
+		kernel = append(kernel, rows...)
 	}
+}
 
-	//On enregistrera l'image traitée reçue dans le répertoire propre à ce client
-	outputPath := filepath.Join(clientDir, "modifiee_"+processedImgData.Name)
-	if err := os.WriteFile(outputPath, processedImgData.Data, 0644); err != nil {
-		fmt.Println("Erreur lors de la sauvegarde de l'image traitée :", err)
-		return
+// demanderParametres propose à l'utilisateur de régler chacun des paramètres du filtre choisi
+// une entrée vide garde la valeur par défaut ; le serveur vérifie ensuite que les valeurs sont dans les limites
+func demanderParametres(scanner *bufio.Scanner, filter shared.Filter) (shared.Filter, bool) {
+	for _, spec := range shared.FilterParams[filter.Name] {
+		for { // Boucle jusqu'à obtenir un nombre (ou une entrée vide)
+			kind := "réel"
+			if spec.Integer {
+				kind = "entier"
+			}
+			fmt.Printf("%s - %s (%s entre %g et %g, Entrée pour %g) : ", spec.Name, spec.Description, kind, spec.Min, spec.Max, spec.Default)
+			if !scanner.Scan() {
+				return filter, false
+			}
+			input := strings.TrimSpace(scanner.Text())
+			if input == "" {
+				break
+			}
+			value, err := strconv.ParseFloat(strings.Replace(input, ",", ".", 1), 64) // On accepte aussi la virgule décimale
+			if err != nil {
+				fmt.Println("Valeur invalide, veuillez entrer un nombre.")
+				continue
+			}
+			if filter.Params == nil {
+				filter.Params = make(map[string]float64)
+			}
+			filter.Params[spec.Name] = value
+			break
+		}
 	}
-
-	fmt.Println("Image traitée sauvegardée sous :", outputPath)
+	return filter, true
 }
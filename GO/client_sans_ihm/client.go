@@ -2,95 +2,266 @@ package main
 
 import (
 	"GO/shared"
+	"crypto/tls"
 	"encoding/gob"
+	"flag"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
-const adresse_server = "localhost:9000"
+const adresse_server = "localhost:9000" // Adresse du serveur quand l'option -server n'est pas donnée
+
+// codeErreurLocale est le code de sortie des erreurs locales (arguments, connexion, TLS, fichiers...) :
+// aucune catégorie d'erreur du serveur ne l'utilise, voir shared.ErrorCategory.ExitCode
+const codeErreurLocale = 1
 
 func init() {
 	gob.Register(shared.ImageData{})
+	gob.Register(shared.Response{})
+}
+
+// requete associe une image à traiter aux filtres demandés
+type requete struct {
+	imagePath string
+	pipeline  shared.Pipeline
+}
+
+// session regroupe la connexion au serveur et ce qui sert à échanger avec lui pendant toute la session
+type session struct {
+	conn    net.Conn
+	encoder *gob.Encoder
+	decoder *gob.Decoder
 }
 
 func main() {
-	if len(os.Args) < 3 {
-		fmt.Println("Pour lancer : go run client.go <image_path> <filter_type>")
-		return
-	}
+	os.Exit(lancer())
+}
 
-	//On utilise os.Args pour récupérer les arguments passés au programme
-	imagePath := os.Args[1]
-	filterType := os.Args[2]
+// lancer exécute les requêtes demandées et renvoie le code de sortie du client : 0 si tout s'est bien passé,
+// codeErreurLocale pour une erreur survenue de ce côté (connexion, TLS, fichiers...). Les erreurs renvoyées par le serveur
+// arrêtent le client avec le code propre à leur catégorie (voir shared.ErrorCategory.ExitCode)
+func lancer() int {
+	serveur := flag.String("server", adresse_server, "adresse du serveur : hôte:port, ou unix:///chemin pour une socket Unix")
+	jeton := flag.String("jeton", os.Getenv("FILTRES_JETON"), "jeton d'accès au serveur (variable FILTRES_JETON par défaut, pour ne pas le laisser dans l'historique du shell)")
+	tlsActif := flag.Bool("tls", false, "chiffrer la connexion avec TLS (implicite avec -tls-ca ou -tls-cert)")
+	tlsCA := flag.String("tls-ca", "", "fichier PEM des autorités qui ont signé le certificat du serveur (celles du système par défaut)")
+	tlsCert := flag.String("tls-cert", "", "certificat PEM présenté au serveur, quand il vérifie les certificats des clients")
+	tlsCle := flag.String("tls-cle", "", "clé privée PEM du certificat -tls-cert")
+	async := flag.Bool("async", false, "soumettre les images comme travaux asynchrones et afficher leurs identifiants")
+	statut := flag.String("statut", "", "afficher l'état du travail d'identifiant donné")
+	recuperer := flag.String("recuperer", "", "récupérer le résultat du travail d'identifiant donné")
+	attendre := flag.Bool("attendre", false, "avec -recuperer, attendre la fin du travail")
+	format := flag.String("format", "", "format des images traitées (jpeg, png ou gif), le même que l'image envoyée par défaut")
+	strategie := flag.String("strategie", "", "répartition des calculs sur le serveur (sequentielle, lignes, tuiles ou comparaison), celle du serveur par défaut")
+	flag.Usage = func() {
+		fmt.Println("Pour lancer : go run client.go [options] <image_path> <filter> [<image_path> <filter> ...]")
+		fmt.Println("         ou : go run client.go [options] -statut <id>")
+		fmt.Println("         ou : go run client.go [options] -recuperer <id> [-attendre]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
 
-	fileData, err := os.ReadFile(imagePath)
-	if err != nil {
-		fmt.Println("Erreur lors de la lecture du fichier :", err)
-		return
-	}
-
-	var filter int
-	switch filterType {
-	case "1":
-		filter = 1
-	case "2":
-		filter = 2
-	case "3":
-		filter = 3
-	case "4":
-		filter = 4
-	default:
-		fmt.Println("Filtre non reconnu. Veuillez choisir un filtre entre 1 et 4.")
-		fmt.Println("Rappel : 1 - Niveaux de gris ; 2 - Détection de contours ; 3 - Netteté ; 4 - Flou gaussien")
-		return
+	//On attend des couples <image_path> <filter_type>, qui seront tous traités sur la même connexion
+	var requetes []requete
+	if *statut == "" && *recuperer == "" {
+		if len(args) < 2 || len(args)%2 != 0 {
+			flag.Usage()
+			return codeErreurLocale
+		}
+		var ok bool
+		if requetes, ok = lireRequetes(args); !ok {
+			return codeErreurLocale
+		}
 	}
 
 	//connexion au serveur
-	conn, err := net.Dial("tcp", adresse_server)
+	var tlsConfig *tls.Config
+	if *tlsActif || *tlsCA != "" || *tlsCert != "" {
+		var err error
+		if tlsConfig, err = shared.ClientTLSConfig(*tlsCA, *tlsCert, *tlsCle); err != nil {
+			fmt.Println("Configuration TLS invalide :", err)
+			return codeErreurLocale
+		}
+	}
+	conn, err := shared.Dial(*serveur, tlsConfig)
 	if err != nil {
 		fmt.Println("Erreur lors de la connexion au serveur :", err)
-		return
+		return codeErreurLocale
 	}
 	defer conn.Close()
 
-	//Préparation des données image pour l'envoi après encodage
-	imgData := shared.ImageData{
-		Name:       filepath.Base(imagePath),
-		Data:       fileData,
-		FilterType: filter,
+	//L'encodeur et le décodeur sont réutilisés pour toutes les requêtes de la session
+	s := &session{conn: conn, encoder: gob.NewEncoder(conn), decoder: gob.NewDecoder(conn)}
+	if _, ok := s.authentifier(*jeton); !ok {
+		return codeErreurLocale
 	}
+	defer s.fermer()
 
+	// Création d'un sous-répertoire pour ce client (évite de tous les mélanger et d'avoir des problèmes de noms de fichiers)
+	clientDir := filepath.Join("client_images", fmt.Sprintf("client_%d", time.Now().UnixNano()))
+
+	switch {
+	case *statut != "":
+		response, ok := s.envoyer(shared.ImageData{Action: shared.ActionStatus, JobID: *statut, RequestID: 1})
+		if !ok {
+			return codeErreurLocale
+		}
+		fmt.Printf("Travail %s : %s\n", response.JobID, response.JobState)
+		if response.JobState == shared.JobFailed {
+			fmt.Println("Raison de l'échec :", response.Message)
+		}
+
+	case *recuperer != "":
+		response, ok := s.envoyer(shared.ImageData{Action: shared.ActionFetch, JobID: *recuperer, Wait: *attendre, RequestID: 1})
+		if !ok {
+			return codeErreurLocale
+		}
+		if response.Status == shared.StatusAccepted {
+			fmt.Printf("Travail %s pas encore terminé : %s\n", response.JobID, response.JobState)
+			return 0
+		}
+		if !sauvegarder(clientDir, "modifiee_"+response.Image.Name, response.Image.Data) {
+			return codeErreurLocale
+		}
+
+	default:
+		for i, req := range requetes {
+			fileData, err := os.ReadFile(req.imagePath)
+			if err != nil {
+				fmt.Println("Erreur lors de la lecture du fichier :", err)
+				return codeErreurLocale
+			}
+
+			//Préparation des données image pour l'envoi après encodage
+			imgData := shared.ImageData{
+				Name:         filepath.Base(req.imagePath),
+				Data:         fileData,
+				Pipeline:     req.pipeline,
+				RequestID:    uint64(i + 1),
+				OutputFormat: *format,
+				Strategy:     shared.Strategy(*strategie),
+			}
+			if *async {
+				imgData.Action = shared.ActionSubmit
+			}
+
+			response, ok := s.envoyer(imgData)
+			if !ok {
+				return codeErreurLocale
+			}
+			if *async {
+				fmt.Printf("Travail %s soumis pour %s (%s)\n", response.JobID, imgData.Name, response.JobState)
+				continue
+			}
+
+			//Enregistrement de l'image traitée reçue dans le répertoire propre à ce client
+			//(avec plusieurs requêtes, on préfixe par l'identifiant de la requête pour ne pas écraser une image de même nom)
+			outputName := "modifiee_" + response.Image.Name
+			if len(requetes) > 1 {
+				outputName = fmt.Sprintf("modifiee_%d_%s", response.RequestID, response.Image.Name)
+			}
+			if !sauvegarder(clientDir, outputName, response.Image.Data) {
+				return codeErreurLocale
+			}
+		}
+	}
+	return 0
+}
+
+// lireRequetes lit les couples <image_path> <filter> passés en arguments
+func lireRequetes(args []string) ([]requete, bool) {
+	var requetes []requete
+	for i := 0; i < len(args); i += 2 {
+		imagePath := args[i]
+		filterType := args[i+1]
+
+		//Le filtre peut être un numéro (1 à 4) ou un nom suivi de ses paramètres, comme "flou:rayon=3,sigma=1.5"
+		//et plusieurs filtres peuvent être enchaînés avec des "+", comme "gris+flou:rayon=3+contours"
+		pipeline, err := shared.ParsePipeline(filterType)
+		if err != nil {
+			fmt.Println("Filtre non reconnu :", err)
+			fmt.Println("Rappel : 1 - Niveaux de gris ; 2 - Détection de contours ; 3 - Netteté ; 4 - Flou gaussien")
+			fmt.Println("ou bien <nom>[:<param>=<valeur>,...][+<nom>...] avec <nom> parmi :", strings.Join(shared.FilterNames(), ", "))
+			return nil, false
+		}
+		requetes = append(requetes, requete{imagePath: imagePath, pipeline: pipeline})
+	}
+	return requetes, true
+}
+
+// authentifier ouvre la session en présentant le jeton d'accès au serveur, avant toute requête
+// si le serveur refuse le client, on affiche son message et on s'arrête avec le code propre à la catégorie d'erreur
+func (s *session) authentifier(jeton string) (shared.Response, bool) {
+	if err := s.encoder.Encode(shared.Authentication{Token: jeton}); err != nil {
+		fmt.Println("Erreur lors de l'authentification :", err)
+		return shared.Response{}, false
+	}
+	var response shared.Response
+	if err := s.decoder.Decode(&response); err != nil {
+		fmt.Println("Erreur lors de l'authentification :", err)
+		return shared.Response{}, false
+	}
+	if response.Status != shared.StatusOK {
+		fmt.Printf("Le serveur a refusé la connexion (%d, %s) : %s\n", response.Status, response.Category, response.Message)
+		os.Exit(response.Category.ExitCode())
+	}
+	return response, true
+}
+
+// envoyer transmet une requête au serveur et attend sa réponse
+// si le serveur renvoie une erreur, on affiche son message et on s'arrête avec le code propre à la catégorie d'erreur
+func (s *session) envoyer(imgData shared.ImageData) (shared.Response, bool) {
 	//envoi des données image encodées
-	encoder := gob.NewEncoder(conn)
-	if err := encoder.Encode(imgData); err != nil {
-		fmt.Println("Erreur lors de l'envoi de l'image :", err)
-		return
+	if err := s.encoder.Encode(imgData); err != nil {
+		// Le serveur peut refuser une requête sans la lire jusqu'au bout (message trop volumineux) : si sa réponse
+		// est arrivée avant la fermeture de la connexion, elle explique mieux le problème que l'erreur d'envoi
+		var response shared.Response
+		if s.decoder.Decode(&response) == nil && response.Status != shared.StatusOK && response.Status != shared.StatusAccepted {
+			fmt.Printf("Le serveur n'a pas pu traiter la requête %d (%d, %s) : %s\n", imgData.RequestID, response.Status, response.Category, response.Message)
+			os.Exit(response.Category.ExitCode())
+		}
+		fmt.Println("Erreur lors de l'envoi de la requête :", err)
+		return shared.Response{}, false
 	}
 
-	//décodage de l'image traitée par le serveur qui est reçue par la connexion
-	var processedImgData shared.ImageData
-	decoder := gob.NewDecoder(conn)
-	if err := decoder.Decode(&processedImgData); err != nil {
-		fmt.Println("Erreur lors de la réception de l'image traitée :", err)
-		return
+	//décodage de la réponse du serveur qui est reçue par la connexion
+	var response shared.Response
+	if err := s.decoder.Decode(&response); err != nil {
+		fmt.Println("Erreur lors de la réception de la réponse :", err)
+		return shared.Response{}, false
+	}
+	if response.Status != shared.StatusOK && response.Status != shared.StatusAccepted {
+		fmt.Printf("Le serveur n'a pas pu traiter la requête %d (%d, %s) : %s\n", response.RequestID, response.Status, response.Category, response.Message)
+		s.fermer()
+		s.conn.Close()
+		os.Exit(response.Category.ExitCode())
 	}
+	return response, true
+}
 
-	// Création d'un sous-répertoire pour ce client (évite de tous les mélanger et d'avoir des problèmes de noms de fichiers)
-	clientDir := filepath.Join("client_images", fmt.Sprintf("client_%d", time.Now().UnixNano()))
+// fermer prévient le serveur que la session est terminée
+func (s *session) fermer() {
+	if err := s.encoder.Encode(shared.ImageData{Close: true}); err != nil {
+		fmt.Println("Erreur lors de la fermeture de la session :", err)
+	}
+}
+
+// sauvegarder enregistre une image traitée dans le répertoire propre à ce client, créé au besoin
+func sauvegarder(clientDir, name string, data []byte) bool {
 	if err := os.MkdirAll(clientDir, 0755); err != nil {
 		fmt.Println("Erreur lors de la création du répertoire client :", err)
-		return
+		return false
 	}
-
-	//Enregistrement de l'image traitée reçue dans le répertoire propre à ce client
-	outputPath := filepath.Join(clientDir, "modifiee_"+processedImgData.Name)
-	if err := os.WriteFile(outputPath, processedImgData.Data, 0644); err != nil {
+	outputPath := filepath.Join(clientDir, name)
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
 		fmt.Println("Erreur lors de la sauvegarde de l'image traitée :", err)
-		return
+		return false
 	}
-
 	fmt.Println("Image traitée sauvegardée sous :", outputPath)
+	return true
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// erreurOccupe signale que le serveur ne peut pas accepter une requête pour le moment,
+// avec une estimation du délai après lequel le client peut réessayer
+type erreurOccupe struct {
+	raison     string
+	retryAfter time.Duration
+}
+
+func (e *erreurOccupe) Error() string {
+	return fmt.Sprintf("serveur occupé (%s), réessayez dans %d s", e.raison, secondes(e.retryAfter))
+}
+
+// controleAdmission limite le nombre de filtrages exécutés en même temps sur tout le serveur.
+// Les requêtes qui ne trouvent pas de place attendent dans une file de taille limitée ; quand elle est pleine, elles sont refusées.
+type controleAdmission struct {
+	places     chan struct{} // Un jeton par filtrage en cours
+	maxAttente int           // Nombre maximal de requêtes qui peuvent attendre une place
+
+	mu           sync.Mutex
+	enAttente    int           // Nombre de requêtes qui attendent une place
+	dureeMoyenne time.Duration // Durée moyenne d'un filtrage, pour estimer le délai avant de réessayer
+}
+
+// admission est le contrôle d'admission partagé par toutes les connexions (gob et HTTP) et par les workers des travaux
+var admission *controleAdmission
+
+// nouveauControleAdmission crée un contrôle d'admission autorisant maxFiltrages filtrages simultanés
+// et maxAttente requêtes en attente
+func nouveauControleAdmission(maxFiltrages, maxAttente int) *controleAdmission {
+	return &controleAdmission{
+		places:       make(chan struct{}, maxFiltrages),
+		maxAttente:   maxAttente,
+		dureeMoyenne: time.Second,
+	}
+}
+
+// entrer réserve une place pour un filtrage, en attendant si besoin qu'une place se libère ;
+// si la file d'attente est déjà pleine, la requête est refusée avec une erreurOccupe. L'attente est abandonnée
+// (avec l'erreur du contexte) si ctx est annulé, par exemple à l'arrêt du serveur
+func (a *controleAdmission) entrer(ctx context.Context) error {
+	select {
+	case a.places <- struct{}{}: // Une place est libre tout de suite
+		return nil
+	default:
+	}
+
+	a.mu.Lock()
+	if a.enAttente >= a.maxAttente {
+		retryAfter := a.estimerAttente()
+		a.mu.Unlock()
+		return &erreurOccupe{raison: fmt.Sprintf("file d'attente pleine, %d requête(s)", a.maxAttente), retryAfter: retryAfter}
+	}
+	a.enAttente++
+	a.mu.Unlock()
+
+	var err error
+	select {
+	case a.places <- struct{}{}:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	a.mu.Lock()
+	a.enAttente--
+	a.mu.Unlock()
+	return err
+}
+
+// attendre réserve une place sans limite de file d'attente : les workers des travaux asynchrones sont déjà en nombre limité.
+// Comme entrer, elle renvoie l'erreur du contexte si ctx est annulé avant qu'une place se libère
+func (a *controleAdmission) attendre(ctx context.Context) error {
+	select {
+	case a.places <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sortir libère la place réservée par entrer ou attendre, et met à jour la durée moyenne d'un filtrage
+func (a *controleAdmission) sortir(debut time.Time) {
+	<-a.places
+
+	a.mu.Lock()
+	a.dureeMoyenne = (a.dureeMoyenne*7 + time.Since(debut)) / 8 // Moyenne glissante, pour suivre la charge récente
+	a.mu.Unlock()
+}
+
+// delaiConseille estime au bout de combien de temps un client refusé a des chances d'obtenir une place
+func (a *controleAdmission) delaiConseille() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.estimerAttente()
+}
+
+// estimerAttente estime le temps nécessaire pour écouler la file d'attente (a.mu doit être verrouillé)
+func (a *controleAdmission) estimerAttente() time.Duration {
+	tours := float64(a.enAttente+1) / float64(cap(a.places))
+	return time.Duration(math.Ceil(tours)) * a.dureeMoyenne
+}
+
+// secondes arrondit une durée au nombre de secondes supérieur, avec au moins une seconde
+func secondes(d time.Duration) int {
+	s := int(math.Ceil(d.Seconds()))
+	if s < 1 {
+		return 1
+	}
+	return s
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// errArret est renvoyée aux requêtes qui ne peuvent plus être traitées parce que le serveur s'arrête
+var errArret = errors.New("serveur en cours d'arrêt")
+
+// registreConnexions garde la trace des sessions gob ouvertes, pour pouvoir les fermer à l'arrêt du serveur :
+// une session qui attend la requête suivante est fermée tout de suite, une session occupée l'est après l'envoi de sa réponse
+type registreConnexions struct {
+	mu       sync.Mutex
+	arret    bool
+	sessions map[*delaisConnexion]bool // true si la session attend sa prochaine requête
+}
+
+// connexions est le registre des sessions gob de toutes les adresses d'écoute
+var connexions = &registreConnexions{sessions: make(map[*delaisConnexion]bool)}
+
+// ajouter enregistre une nouvelle session ; elle renvoie false si le serveur s'arrête déjà (la connexion doit alors être fermée)
+func (r *registreConnexions) ajouter(d *delaisConnexion) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.arret {
+		return false
+	}
+	r.sessions[d] = false
+	return true
+}
+
+// retirer oublie une session terminée
+func (r *registreConnexions) retirer(d *delaisConnexion) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, d)
+}
+
+// attendre prépare la réception de la prochaine requête d'une session (voir delaisConnexion.attendre) ;
+// elle renvoie false si le serveur s'arrête : la session ne doit pas recevoir d'autre requête
+func (r *registreConnexions) attendre(d *delaisConnexion, delai time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.arret {
+		return false
+	}
+	r.sessions[d] = true
+	d.attendre(delai)
+	return true
+}
+
+// occuper signale qu'une session a commencé à recevoir une requête : elle pourra la terminer même si le serveur s'arrête
+func (r *registreConnexions) occuper(d *delaisConnexion) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sessions[d]; ok {
+		r.sessions[d] = false
+	}
+}
+
+// arreter refuse les nouvelles sessions et interrompt la lecture de celles qui attendent leur prochaine requête
+// (leur Decode échoue aussitôt sur un délai dépassé)
+func (r *registreConnexions) arreter() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.arret = true
+	for d, inactive := range r.sessions {
+		if inactive {
+			d.conn.SetReadDeadline(time.Now())
+		}
+	}
+}
+
+// enArret indique si l'arrêt du serveur a commencé
+func (r *registreConnexions) enArret() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.arret
+}
+
+// fermer ferme de force les connexions des sessions qui ne sont pas encore terminées, et renvoie leur nombre
+func (r *registreConnexions) fermer() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for d := range r.sessions {
+		d.conn.Close()
+	}
+	return len(r.sessions)
+}
+
+// attendreFin attend que tous les groupes de goroutines soient terminés, ou que ctx soit annulé ;
+// elle indique si tout s'est terminé à temps
+func attendreFin(ctx context.Context, groupes ...*sync.WaitGroup) bool {
+	fini := make(chan struct{})
+	go func() {
+		for _, g := range groupes {
+			g.Wait()
+		}
+		close(fini)
+	}()
+	select {
+	case <-fini:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"GO/shared"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// errNonAuthentifie est renvoyée quand un client ne présente pas de jeton, ou un jeton inconnu
+var errNonAuthentifie = errors.New("authentification refusée")
+
+// registreJetons associe chaque jeton d'accès au nom de son client. Seule l'empreinte SHA-256 des jetons est gardée
+// en mémoire : la recherche dans la table ne dépend pas du jeton lui-même, et ne renseigne pas sur les jetons valides
+type registreJetons struct {
+	noms map[[sha256.Size]byte]string
+}
+
+// jetons est le registre des jetons chargé au démarrage, nil quand l'authentification est désactivée
+var jetons *registreJetons
+
+// chargerJetons lit un fichier de jetons : une ligne "nom:jeton" par client, les lignes vides
+// et celles qui commencent par # sont ignorées. Plusieurs jetons peuvent porter le même nom
+func chargerJetons(chemin string) (*registreJetons, error) {
+	f, err := os.Open(chemin)
+	if err != nil {
+		return nil, fmt.Errorf("fichier de jetons : %w", err)
+	}
+	defer f.Close()
+
+	r := &registreJetons{noms: make(map[[sha256.Size]byte]string)}
+	scanner := bufio.NewScanner(f)
+	for ligne := 1; scanner.Scan(); ligne++ {
+		texte := strings.TrimSpace(scanner.Text())
+		if texte == "" || strings.HasPrefix(texte, "#") {
+			continue
+		}
+		nom, jeton, ok := strings.Cut(texte, ":")
+		nom, jeton = strings.TrimSpace(nom), strings.TrimSpace(jeton)
+		if !ok || nom == "" || jeton == "" {
+			return nil, fmt.Errorf("fichier de jetons %s, ligne %d : \"nom:jeton\" attendu", chemin, ligne)
+		}
+		empreinte := sha256.Sum256([]byte(jeton))
+		if autre, existe := r.noms[empreinte]; existe {
+			return nil, fmt.Errorf("fichier de jetons %s, ligne %d : jeton déjà attribué à %s", chemin, ligne, autre)
+		}
+		r.noms[empreinte] = nom
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("fichier de jetons %s : %w", chemin, err)
+	}
+	if len(r.noms) == 0 {
+		return nil, fmt.Errorf("fichier de jetons %s : aucun jeton", chemin)
+	}
+	return r, nil
+}
+
+// authentifier renvoie le nom sous lequel un client apparaît dans les journaux : "Client <nom du jeton>",
+// ou un nom anonyme ("Client 3") si l'authentification est désactivée
+func authentifier(jeton string) (string, error) {
+	if jetons == nil {
+		return nouvelIdentifiant(), nil
+	}
+	if jeton == "" {
+		return "", fmt.Errorf("%w : jeton manquant", errNonAuthentifie)
+	}
+	nom, ok := jetons.noms[sha256.Sum256([]byte(jeton))]
+	if !ok {
+		return "", fmt.Errorf("%w : jeton inconnu", errNonAuthentifie)
+	}
+	return "Client " + nom, nil
+}
+
+// authentifierSession lit le message d'authentification qui ouvre chaque session gob, avant toute image, et y répond :
+// StatusOK si le client est accepté, une erreur de catégorie CategoryUnauthorized sinon (la connexion est alors fermée)
+func authentifierSession(decoder *gob.Decoder, encoder *gob.Encoder) (string, error) {
+	var auth shared.Authentication
+	if err := decoder.Decode(&auth); err != nil {
+		if errors.Is(err, errTropVolumineux) {
+			encoder.Encode(reponseErreur(0, err))
+		}
+		return "", fmt.Errorf("message d'authentification illisible : %w", err)
+	}
+	client, err := authentifier(auth.Token)
+	response := shared.Response{Status: shared.StatusOK, Message: "connecté en tant que " + client}
+	if err != nil {
+		response = reponseErreur(0, err)
+	}
+	if errEnvoi := encoder.Encode(response); errEnvoi != nil && err == nil {
+		return "", fmt.Errorf("erreur lors de l'envoi de la réponse d'authentification : %w", errEnvoi)
+	}
+	return client, err
+}
+
+// cleClientHTTP est la clé sous laquelle le nom du client est rangé dans le contexte d'une requête HTTP
+type cleClientHTTP struct{}
+
+// authentifierHTTP vérifie le jeton de chaque requête HTTP (en-tête "Authorization: Bearer <jeton>")
+// et transmet le nom du client aux handlers, qui le retrouvent avec clientHTTP
+func authentifierHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jeton, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		client, err := authentifier(strings.TrimSpace(jeton))
+		if err != nil {
+			journal.Warn("Requête HTTP refusée", "adresse", r.RemoteAddr, "erreur", err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="filtres"`)
+			ecrireErreurHTTP(w, reponseErreur(0, err))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), cleClientHTTP{}, client)))
+	})
+}
+
+// clientHTTP renvoie le nom du client qui a envoyé une requête HTTP, établi par authentifierHTTP
+func clientHTTP(r *http.Request) string {
+	client, _ := r.Context().Value(cleClientHTTP{}).(string)
+	return client
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"GO/shared"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// prefixeEnv précède le nom des variables d'environnement lues par le serveur : -max-filtrages devient FILTRES_MAX_FILTRAGES
+const prefixeEnv = "FILTRES_"
+
+// configuration regroupe les réglages du serveur. Chaque réglage peut venir, du moins au plus prioritaire :
+// de sa valeur par défaut, du fichier de configuration JSON (-config ou FILTRES_CONFIG), d'une variable d'environnement
+// ou de la ligne de commande. Les clés du fichier sont les noms des options, avec des "_" à la place des "-".
+type configuration struct {
+	Adresse             string      `json:"adresse"`               // Adresse d'écoute du protocole gob (TCP)
+	AdresseHTTP         string      `json:"adresse_http"`          // Adresse d'écoute de l'API HTTP, vide pour la désactiver
+	SocketUnix          string      `json:"socket_unix"`           // Chemin d'une socket Unix où le protocole gob est aussi servi, vide pour ne pas en créer
+	PermissionsSocket   permissions `json:"permissions_socket"`    // Permissions du fichier de la socket Unix
+	CertificatTLS       string      `json:"tls_cert"`              // Certificat PEM du serveur : s'il est donné, le protocole gob en TCP et l'API HTTP passent par TLS
+	CleTLS              string      `json:"tls_cle"`               // Clé privée PEM du certificat du serveur
+	CAClientsTLS        string      `json:"tls_ca_clients"`        // Autorités qui signent les certificats des clients : s'il est donné, chaque client doit présenter un certificat
+	MaxFiltrages        int         `json:"max_filtrages"`         // Nombre maximal de filtrages exécutés en même temps
+	MaxAttente          int         `json:"max_attente"`           // Nombre maximal de requêtes en attente d'un filtrage
+	Workers             int         `json:"workers"`               // Nombre de goroutines qui calculent les convolutions
+	Strategie           string      `json:"strategie"`             // Stratégie d'exécution quand la requête n'en demande pas
+	WorkersTravaux      int         `json:"workers_travaux"`       // Nombre de travaux asynchrones traités en même temps
+	CapaciteTravaux     int         `json:"capacite_travaux"`      // Nombre maximal de travaux en attente dans la file
+	DureeConservation   duree       `json:"duree_conservation"`    // Durée pendant laquelle le résultat d'un travail reste disponible
+	TailleMaxMessage    int64       `json:"taille_max_message"`    // Taille maximale d'un message gob (image comprise), en octets
+	MegapixelsMax       float64     `json:"megapixels_max"`        // Dimensions maximales d'une image, en mégapixels
+	DelaiInactivite     duree       `json:"delai_inactivite"`      // Durée maximale entre deux requêtes d'une session gob, avant de la fermer
+	DelaiLecture        duree       `json:"delai_lecture"`         // Durée maximale de réception d'une requête gob, depuis son premier octet
+	DelaiEcriture       duree       `json:"delai_ecriture"`        // Durée maximale d'envoi d'une réponse gob
+	DelaiRequete        duree       `json:"delai_requete"`         // Durée maximale d'une requête gob, de sa réception à l'envoi de sa réponse
+	DelaiArret          duree       `json:"delai_arret"`           // Durée laissée aux requêtes en cours pour se terminer à l'arrêt du serveur
+	TailleMaxHTTP       int64       `json:"taille_max_http"`       // Taille maximale du corps d'une requête HTTP, en octets
+	DelaiHTTP           duree       `json:"delai_http"`            // Durée maximale de lecture d'une requête HTTP et d'écriture de sa réponse
+	RequetesParSeconde  float64     `json:"requetes_par_seconde"`  // Débit de requêtes autorisé par client, 0 pour ne pas le limiter
+	RafaleRequetes      int         `json:"rafale_requetes"`       // Nombre de requêtes qu'un client peut envoyer d'un coup avant d'être limité
+	MegapixelsParMinute float64     `json:"megapixels_par_minute"` // Mégapixels qu'un client peut faire filtrer par minute, 0 pour ne pas les limiter
+	QuotaRequetesJour   int         `json:"quota_requetes_jour"`   // Nombre d'images qu'un client peut faire filtrer par jour, 0 pour ne pas le limiter
+	QuotaMegapixelsJour float64     `json:"quota_megapixels_jour"` // Mégapixels qu'un client peut faire filtrer par jour, 0 pour ne pas les limiter
+	FichierJetons       string      `json:"jetons"`                // Fichier des jetons d'accès des clients ("nom:jeton" par ligne), vide pour ne pas exiger d'authentification
+	NiveauLog           string      `json:"niveau_log"`            // Messages affichés : debug, info, avertissement ou erreur
+	FormatLog           string      `json:"format_log"`            // Format du journal : texte (clé=valeur) ou json
+}
+
+// config est la configuration du serveur, chargée au démarrage
+var config configuration
+
+// configurationParDefaut renvoie les réglages utilisés quand rien d'autre n'est précisé
+func configurationParDefaut() configuration {
+	return configuration{
+		Adresse:           ":9000",
+		AdresseHTTP:       ":8080",
+		PermissionsSocket: 0o660,
+		MaxFiltrages:      runtime.NumCPU(),
+		MaxAttente:        32,
+		Workers:           runtime.GOMAXPROCS(0),
+		Strategie:         string(shared.StrategyTiles),
+		WorkersTravaux:    4,
+		CapaciteTravaux:   100,
+		DureeConservation: duree(10 * time.Minute),
+		TailleMaxMessage:  64 << 20,
+		MegapixelsMax:     100,
+		DelaiInactivite:   duree(5 * time.Minute),
+		DelaiLecture:      duree(time.Minute),
+		DelaiEcriture:     duree(time.Minute),
+		DelaiRequete:      duree(10 * time.Minute),
+		DelaiArret:        duree(30 * time.Second),
+		TailleMaxHTTP:     64 << 20,
+		DelaiHTTP:         duree(5 * time.Minute),
+		RafaleRequetes:    10,
+		NiveauLog:         "info",
+		FormatLog:         "texte",
+	}
+}
+
+// declarerOptions associe une option de la ligne de commande à chaque champ de la configuration
+func declarerOptions(fs *flag.FlagSet, c *configuration) {
+	fs.StringVar(&c.Adresse, "adresse", c.Adresse, "adresse d'écoute du protocole gob, par exemple :9000 ou 127.0.0.1:9000")
+	fs.StringVar(&c.AdresseHTTP, "adresse-http", c.AdresseHTTP, "adresse d'écoute de l'API HTTP (vide pour la désactiver)")
+	fs.StringVar(&c.SocketUnix, "socket-unix", c.SocketUnix, "chemin d'une socket Unix où servir aussi le protocole gob (avec -adresse \"\" pour ne pas écouter en TCP)")
+	fs.Var(&c.PermissionsSocket, "permissions-socket", "permissions du fichier de la socket Unix, en octal")
+	fs.StringVar(&c.CertificatTLS, "tls-cert", c.CertificatTLS, "certificat PEM du serveur, pour chiffrer avec TLS le protocole gob en TCP et l'API HTTP")
+	fs.StringVar(&c.CleTLS, "tls-cle", c.CleTLS, "clé privée PEM du certificat -tls-cert")
+	fs.StringVar(&c.CAClientsTLS, "tls-ca-clients", c.CAClientsTLS, "fichier PEM des autorités qui signent les certificats des clients, pour n'accepter que les clients qui en présentent un (TLS mutuel)")
+	fs.IntVar(&c.MaxFiltrages, "max-filtrages", c.MaxFiltrages, "nombre maximal de filtrages exécutés en même temps")
+	fs.IntVar(&c.MaxAttente, "max-attente", c.MaxAttente, "nombre maximal de requêtes en attente d'un filtrage avant de répondre que le serveur est occupé")
+	fs.IntVar(&c.Workers, "workers", c.Workers, "nombre de goroutines, partagées par toutes les requêtes, qui calculent les convolutions")
+	fs.StringVar(&c.Strategie, "strategie", c.Strategie, "répartition des convolutions entre les goroutines quand la requête n'en demande pas (sequentielle, lignes, tuiles ou comparaison)")
+	fs.IntVar(&c.WorkersTravaux, "workers-travaux", c.WorkersTravaux, "nombre de travaux asynchrones traités en même temps")
+	fs.IntVar(&c.CapaciteTravaux, "capacite-travaux", c.CapaciteTravaux, "nombre maximal de travaux asynchrones en attente")
+	fs.Var(&c.DureeConservation, "duree-conservation", "durée pendant laquelle le résultat d'un travail terminé reste disponible (par exemple 10m)")
+	fs.Int64Var(&c.TailleMaxMessage, "taille-max-message", c.TailleMaxMessage, "taille maximale d'un message gob (image comprise), en octets")
+	fs.Float64Var(&c.MegapixelsMax, "megapixels-max", c.MegapixelsMax, "dimensions maximales d'une image, en mégapixels (largeur x hauteur / 1 000 000), vérifiées avant de la décoder")
+	fs.Var(&c.DelaiInactivite, "delai-inactivite", "durée après laquelle une session gob sans nouvelle requête est fermée (et une connexion HTTP inactive)")
+	fs.Var(&c.DelaiLecture, "delai-lecture", "durée maximale de réception d'une requête gob depuis son premier octet (et de la poignée de main TLS, et des en-têtes HTTP)")
+	fs.Var(&c.DelaiEcriture, "delai-ecriture", "durée maximale d'envoi d'une réponse gob")
+	fs.Var(&c.DelaiRequete, "delai-requete", "durée maximale d'une requête gob, de sa réception à l'envoi de sa réponse")
+	fs.Var(&c.DelaiArret, "delai-arret", "durée laissée aux requêtes en cours pour se terminer à l'arrêt du serveur, avant de les interrompre")
+	fs.Int64Var(&c.TailleMaxHTTP, "taille-max-http", c.TailleMaxHTTP, "taille maximale du corps d'une requête HTTP, en octets")
+	fs.Var(&c.DelaiHTTP, "delai-http", "durée maximale de lecture d'une requête HTTP et d'écriture de sa réponse (par exemple 30s)")
+	fs.StringVar(&c.FichierJetons, "jetons", c.FichierJetons, "fichier des jetons d'accès (une ligne \"nom:jeton\" par client) : sans lui, le serveur accepte tous les clients")
+	fs.Float64Var(&c.RequetesParSeconde, "requetes-par-seconde", c.RequetesParSeconde, "requêtes par seconde autorisées à chaque client (0 : pas de limite)")
+	fs.IntVar(&c.RafaleRequetes, "rafale-requetes", c.RafaleRequetes, "requêtes qu'un client peut envoyer d'un coup avant que -requetes-par-seconde s'applique")
+	fs.Float64Var(&c.MegapixelsParMinute, "megapixels-par-minute", c.MegapixelsParMinute, "mégapixels que chaque client peut faire filtrer par minute (0 : pas de limite)")
+	fs.IntVar(&c.QuotaRequetesJour, "quota-requetes-jour", c.QuotaRequetesJour, "images que chaque client peut faire filtrer par jour (0 : pas de quota)")
+	fs.Float64Var(&c.QuotaMegapixelsJour, "quota-megapixels-jour", c.QuotaMegapixelsJour, "mégapixels que chaque client peut faire filtrer par jour (0 : pas de quota)")
+	fs.StringVar(&c.NiveauLog, "niveau-log", c.NiveauLog, "messages affichés : debug (tous), info, avertissement (requêtes refusées) ou erreur (seulement les erreurs)")
+	fs.StringVar(&c.FormatLog, "format-log", c.FormatLog, "format du journal, écrit sur la sortie d'erreur : texte (clé=valeur) ou json (un objet par ligne)")
+}
+
+// chargerConfiguration construit la configuration à partir des valeurs par défaut, du fichier de configuration,
+// des variables d'environnement puis de la ligne de commande (chaque source l'emporte sur les précédentes)
+func chargerConfiguration(args []string) (configuration, error) {
+	c := configurationParDefaut()
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	chemin := fs.String("config", os.Getenv(prefixeEnv+"CONFIG"), "fichier de configuration JSON")
+	declarerOptions(fs, &c)
+
+	// Un premier passage sur la ligne de commande sert seulement à connaître le fichier de configuration :
+	// on repart ensuite des valeurs par défaut pour appliquer les sources dans l'ordre
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+	c = configurationParDefaut()
+
+	if *chemin != "" {
+		if err := lireFichierConfiguration(*chemin, &c); err != nil {
+			return c, err
+		}
+	}
+
+	var errEnv error
+	fs.VisitAll(func(f *flag.Flag) {
+		nom := prefixeEnv + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if valeur, ok := os.LookupEnv(nom); ok && f.Name != "config" && errEnv == nil {
+			if err := f.Value.Set(valeur); err != nil {
+				errEnv = fmt.Errorf("variable d'environnement %s : %w", nom, err)
+			}
+		}
+	})
+	if errEnv != nil {
+		return c, errEnv
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+	if fs.NArg() > 0 {
+		return c, fmt.Errorf("argument inattendu : %q", fs.Arg(0))
+	}
+	// La socket peut être donnée sous la même forme qu'aux clients : unix:///chemin
+	c.SocketUnix = strings.TrimPrefix(c.SocketUnix, shared.UnixScheme)
+	return c, c.valider()
+}
+
+// lireFichierConfiguration applique à c les réglages présents dans un fichier JSON (les autres gardent leur valeur)
+func lireFichierConfiguration(chemin string, c *configuration) error {
+	data, err := os.ReadFile(chemin)
+	if err != nil {
+		return fmt.Errorf("lecture du fichier de configuration : %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields() // Une faute de frappe dans une clé ne doit pas passer inaperçue
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("fichier de configuration %s : %w", chemin, err)
+	}
+	return nil
+}
+
+// valider vérifie que les réglages sont cohérents
+func (c configuration) valider() error {
+	var erreurs []error
+	if c.Adresse == "" && c.SocketUnix == "" {
+		erreurs = append(erreurs, errors.New("il faut au moins une adresse d'écoute (-adresse ou -socket-unix)"))
+	}
+	if c.MaxFiltrages < 1 || c.Workers < 1 || c.WorkersTravaux < 1 || c.CapaciteTravaux < 1 {
+		erreurs = append(erreurs, errors.New("-max-filtrages, -workers, -workers-travaux et -capacite-travaux doivent être au moins 1"))
+	}
+	if c.MaxAttente < 0 {
+		erreurs = append(erreurs, errors.New("-max-attente doit être positif"))
+	}
+	if c.DelaiInactivite <= 0 || c.DelaiLecture <= 0 || c.DelaiEcriture <= 0 || c.DelaiRequete <= 0 || c.DelaiArret <= 0 {
+		erreurs = append(erreurs, errors.New("-delai-inactivite, -delai-lecture, -delai-ecriture, -delai-requete et -delai-arret doivent être strictement positifs"))
+	}
+	if c.TailleMaxMessage < 1 || c.MegapixelsMax <= 0 || c.TailleMaxHTTP < 1 || c.DureeConservation <= 0 || c.DelaiHTTP <= 0 {
+		erreurs = append(erreurs, errors.New("-taille-max-message, -megapixels-max, -taille-max-http, -duree-conservation et -delai-http doivent être strictement positifs"))
+	}
+	if c.RequetesParSeconde < 0 || c.MegapixelsParMinute < 0 || c.QuotaRequetesJour < 0 || c.QuotaMegapixelsJour < 0 {
+		erreurs = append(erreurs, errors.New("les limites par client et les quotas doivent être positifs (0 pour les désactiver)"))
+	}
+	if c.RafaleRequetes < 1 {
+		erreurs = append(erreurs, errors.New("-rafale-requetes doit être au moins 1"))
+	}
+	if (c.CertificatTLS == "") != (c.CleTLS == "") {
+		erreurs = append(erreurs, errors.New("-tls-cert et -tls-cle doivent être donnés ensemble"))
+	}
+	if c.CAClientsTLS != "" && c.CertificatTLS == "" {
+		erreurs = append(erreurs, errors.New("-tls-ca-clients demande aussi -tls-cert et -tls-cle"))
+	}
+	// Sans TLS, les jetons ne doivent circuler en clair que sur la machine du serveur (adresses locales, socket Unix)
+	if c.FichierJetons != "" && c.Adresse != "" && c.CertificatTLS == "" && !adresseLocale(c.Adresse) {
+		erreurs = append(erreurs, errors.New("-jetons : les jetons circuleraient en clair sur le protocole gob ; il faut -tls-cert et -tls-cle, une -adresse locale (comme 127.0.0.1:9000) ou seulement la socket Unix (-adresse \"\" -socket-unix ...)"))
+	}
+	if c.FichierJetons != "" && c.AdresseHTTP != "" && c.CertificatTLS == "" && !adresseLocale(c.AdresseHTTP) {
+		erreurs = append(erreurs, errors.New("-jetons : les jetons circuleraient en clair sur l'API HTTP ; il faut -tls-cert et -tls-cle, une -adresse-http locale (comme 127.0.0.1:8080) ou -adresse-http \"\""))
+	}
+	if _, err := nouveauJournal(c.FormatLog, c.NiveauLog); err != nil {
+		erreurs = append(erreurs, err)
+	}
+	return errors.Join(erreurs...)
+}
+
+// adresseLocale indique si une adresse d'écoute n'est joignable que depuis la machine du serveur (localhost ou une adresse de bouclage)
+func adresseLocale(adresse string) bool {
+	hote, _, err := net.SplitHostPort(adresse)
+	if err != nil {
+		return false
+	}
+	if hote == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(hote)
+	return ip != nil && ip.IsLoopback()
+}
+
+// duree est une durée qui s'écrit comme "30s" ou "10m", aussi bien dans le fichier de configuration que sur la ligne de commande
+type duree time.Duration
+
+func (d duree) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *duree) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duree(v)
+	return nil
+}
+
+func (d *duree) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("durée attendue sous forme de texte, comme \"30s\" : %s", data)
+	}
+	return d.Set(s)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// surveillanceDeconnexion guette la déconnexion d'un client gob pendant le traitement de sa requête : la session ne lit rien
+// pendant le filtrage, et sans elle, le serveur ne s'apercevrait du départ du client qu'en lui envoyant la réponse
+type surveillanceDeconnexion struct {
+	conn       net.Conn
+	fini       chan struct{}
+	deconnecte bool // Écrit par la goroutine de surveillance, à lire seulement après la fermeture de fini
+}
+
+// surveillerDeconnexion attend en arrière-plan le premier octet qui suit la requête en cours, sans le consommer :
+// si la connexion est fermée avant, annuler est appelée pour interrompre le filtrage devenu inutile.
+// Un client qui envoie déjà sa requête suivante n'est plus surveillé (il est toujours là).
+// arreter doit être appelée avant de lire la requête suivante
+func surveillerDeconnexion(conn net.Conn, lecteur *lecteurGob, annuler context.CancelFunc) *surveillanceDeconnexion {
+	s := &surveillanceDeconnexion{conn: conn, fini: make(chan struct{})}
+	conn.SetReadDeadline(time.Time{}) // Le filtrage peut durer jusqu'à DelaiRequete : c'est son contexte qui l'arrête
+	go func() {
+		defer close(s.fini)
+		if _, err := lecteur.r.Peek(1); err != nil && !estDelaiDepasse(err) {
+			s.deconnecte = true
+			annuler()
+		}
+	}()
+	return s
+}
+
+// arreter termine la surveillance (en débloquant la lecture en attente) et indique si le client s'est déconnecté
+func (s *surveillanceDeconnexion) arreter() bool {
+	s.conn.SetReadDeadline(time.Now())
+	<-s.fini
+	return s.deconnecte
+}
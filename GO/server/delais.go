@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+// errDelaiDepasse est renvoyée quand une requête n'a pas pu être traitée dans le délai total autorisé
+var errDelaiDepasse = errors.New("délai dépassé")
+
+// delaisConnexion applique à une connexion gob les délais de la configuration, requête par requête :
+//   - entre deux requêtes, le client a DelaiInactivite pour commencer à envoyer la suivante, sinon la session est fermée ;
+//   - dès le premier octet d'une requête, il a DelaiLecture pour finir de l'envoyer ;
+//   - la réponse doit être envoyée en moins de DelaiEcriture ;
+//   - et le tout (réception, traitement et envoi) ne doit pas dépasser DelaiRequete.
+type delaisConnexion struct {
+	conn  net.Conn
+	debut time.Time // Réception du premier octet de la requête en cours, zéro entre deux requêtes
+}
+
+// attendre prépare la réception de la prochaine requête : la connexion sera coupée si rien n'arrive avant delai
+func (d *delaisConnexion) attendre(delai time.Duration) {
+	d.debut = time.Time{}
+	d.conn.SetReadDeadline(time.Now().Add(delai))
+}
+
+// debutMessage est appelée par le lecteurGob au premier octet de chaque message ; seul le premier message d'une requête
+// (gob peut en envoyer plusieurs, pour décrire ses types) démarre le décompte des délais de lecture et total
+func (d *delaisConnexion) debutMessage() {
+	if !d.debut.IsZero() {
+		return
+	}
+	d.debut = time.Now()
+	d.conn.SetReadDeadline(d.echeance(time.Duration(config.DelaiLecture)))
+}
+
+// ecrire prépare l'envoi de la réponse : elle doit partir avant DelaiEcriture, et avant la fin du délai total
+// (sauf si ce délai est déjà dépassé : on laisse alors le temps d'envoyer l'erreur qui le signale)
+func (d *delaisConnexion) ecrire() {
+	echeance := d.echeance(time.Duration(config.DelaiEcriture))
+	if d.depasse() {
+		echeance = time.Now().Add(time.Duration(config.DelaiEcriture))
+	}
+	d.conn.SetWriteDeadline(echeance)
+}
+
+// echeance renvoie l'instant situé dans delai, sans aller au-delà du délai total de la requête en cours
+func (d *delaisConnexion) echeance(delai time.Duration) time.Time {
+	echeance := time.Now().Add(delai)
+	if !d.debut.IsZero() {
+		if fin := d.debut.Add(time.Duration(config.DelaiRequete)); fin.Before(echeance) {
+			echeance = fin
+		}
+	}
+	return echeance
+}
+
+// depasse indique si la requête en cours a dépassé son délai total
+func (d *delaisConnexion) depasse() bool {
+	return !d.debut.IsZero() && time.Since(d.debut) > time.Duration(config.DelaiRequete)
+}
+
+// estDelaiDepasse indique si une erreur de lecture ou d'écriture vient d'un délai de la connexion
+func estDelaiDepasse(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
@@ -1,284 +1,443 @@
 package filters
 
 import (
+	"GO/shared"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"image"
-	"image/color"
+	"image/draw"
+	"image/gif"
 	"image/jpeg"
 	"image/png"
-	"os"
+	"io"
 	"strings"
-	"sync"
 	"time"
 )
 
-// ApplyFilters permet l'ouverture du fichier image, la détermination de son format, et de son décodage en un objet image.Image
-// elle englobe l'application du filtre sélectionné à l'image d'entrée selon son extension et la sauvegarde le résultat, en fournissant les paramètres nécessaires à processImage
-func ApplyFilters(filterType int, inputPath, outputPath string) error {
-	// Ouverture de l'image
-	reader, err := os.Open(inputPath)
+// Erreurs renvoyées par Process et ProcessBytes, à tester avec errors.Is pour connaître la nature du problème
+var (
+	ErrUnknownFilter     = errors.New("filtre non reconnu")
+	ErrInvalidParameter  = errors.New("paramètre invalide")
+	ErrInvalidPipeline   = errors.New("pipeline invalide")
+	ErrInvalidImage      = errors.New("image illisible")
+	ErrUnsupportedFormat = errors.New("format d'image non supporté")
+	ErrImageTooLarge     = errors.New("image trop grande")
+)
+
+// ProcessBytes applique les filtres du pipeline à une image encodée en mémoire, et renvoie l'image traitée encodée
+// au format demandé (le format de l'image d'entrée si outputFormat est vide), ainsi que ce format
+func ProcessBytes(ctx context.Context, data []byte, pipeline shared.Pipeline, outputFormat string, strategy shared.Strategy) ([]byte, string, error) {
+	var output bytes.Buffer
+	format, err := Process(ctx, bytes.NewReader(data), &output, pipeline, outputFormat, strategy)
 	if err != nil {
-		return fmt.Errorf("erreur lors de l'ouverture de l'image : %w", err)
+		return nil, "", err
 	}
-	defer reader.Close()
+	return output.Bytes(), format, nil
+}
 
-	// Décodage de l'image en fonction de son extension (jpg ou png!)
-	switch {
-	case strings.HasSuffix(strings.ToLower(inputPath), ".jpg"), strings.HasSuffix(strings.ToLower(inputPath), ".jpeg"):
-		img, err := jpeg.Decode(reader)
-		if err != nil {
-			return fmt.Errorf("erreur lors du décodage de l'image : %w", err)
-		}
-		return processImage(filterType, img, outputPath)
-	case strings.HasSuffix(strings.ToLower(inputPath), ".png"):
-		img, err := png.Decode(reader)
-		if err != nil {
-			return fmt.Errorf("erreur lors du décodage de l'image : %w", err)
-		}
-		return processImage(filterType, img, outputPath)
-	default:
-		return fmt.Errorf("format d'image non supporté : %s", inputPath)
+// Process lit une image depuis r en déterminant son format d'après son contenu, lui applique les filtres du pipeline
+// et écrit le résultat dans w, au format demandé (le format de l'image d'entrée si outputFormat est vide) ;
+// elle renvoie le format dans lequel l'image traitée a été écrite. Aucun fichier n'est utilisé.
+// Les convolutions sont réparties entre les goroutines selon la stratégie demandée (celle fixée par SetStrategy si elle est vide).
+// Si ctx est annulé, les filtres s'arrêtent à la tuile (ou à la bande de lignes) suivante et Process renvoie l'erreur du contexte.
+// La durée de chaque étape est écrite dans le journal de la requête (voir WithLogger) et dans son Timings (voir WithTimings).
+func Process(ctx context.Context, r io.Reader, w io.Writer, pipeline shared.Pipeline, outputFormat string, strategy shared.Strategy) (string, error) {
+	// On vérifie le format de sortie, la stratégie et les filtres avant de décoder l'image, pour ne pas faire le travail pour rien
+	outputFormat = normalizeFormat(outputFormat)
+	if outputFormat != "" && !supportedOutputFormat(outputFormat) {
+		return "", fmt.Errorf("%w en sortie : %q", ErrUnsupportedFormat, outputFormat)
+	}
+	strategy, err := resolveStrategy(strategy)
+	if err != nil {
+		return "", err
+	}
+	params, err := resolvePipeline(pipeline)
+	if err != nil {
+		return "", fmt.Errorf("erreur lors du traitement de l'image : %w", err)
+	}
+
+	// Les dimensions annoncées dans l'en-tête sont vérifiées avant d'allouer quoi que ce soit pour les pixels
+	start := time.Now()
+	header, err := checkedConfig(r)
+	if err != nil {
+		return "", err
 	}
-}
 
-// applique filtre sur image et enregistre le résultat
-func processImage(filterType int, img image.Image, outputPath string) error {
-	processedImg, err := applyFilterToImage(filterType, img)
+	// Décodage de l'image : image.Decode reconnaît le format d'après les premiers octets,
+	// parmi ceux dont le décodeur est enregistré (jpeg, png et gif), quel que soit le nom donné par le client
+	img, format, err := image.Decode(io.MultiReader(bytes.NewReader(header), r))
 	if err != nil {
+		return "", fmt.Errorf("%w : %w", ErrInvalidImage, err)
+	}
+	decode := time.Since(start)
+	timings(ctx).Decode = decode
+	Logger(ctx).Debug("image décodée", "format", format, "largeur", img.Bounds().Dx(), "hauteur", img.Bounds().Dy(), "duree", decode)
+
+	if outputFormat == "" {
+		outputFormat = format
+	}
+	return outputFormat, processImage(ctx, pipeline, params, img, outputFormat, strategy, w)
+}
+
+// Validate vérifie une requête sans décoder son image : format de sortie, stratégie, filtres du pipeline et leurs paramètres.
+// Elle renvoie l'erreur que Process renverrait pour ces mêmes valeurs, ce qui permet de refuser la requête avant d'attendre son tour
+func Validate(pipeline shared.Pipeline, outputFormat string, strategy shared.Strategy) error {
+	outputFormat = normalizeFormat(outputFormat)
+	if outputFormat != "" && !supportedOutputFormat(outputFormat) {
+		return fmt.Errorf("%w en sortie : %q", ErrUnsupportedFormat, outputFormat)
+	}
+	if _, err := resolveStrategy(strategy); err != nil {
+		return err
+	}
+	if _, err := resolvePipeline(pipeline); err != nil {
 		return fmt.Errorf("erreur lors du traitement de l'image : %w", err)
 	}
+	return nil
+}
 
-	// Sauvegarde de l'image traitée
-	outputFile, err := os.Create(outputPath)
+// applique les filtres, dont les paramètres ont déjà été vérifiés, sur image et écrit le résultat encodé au format demandé
+func processImage(ctx context.Context, pipeline shared.Pipeline, params []map[string]float64, img image.Image, format string, strategy shared.Strategy, w io.Writer) error {
+	start := time.Now()
+	processedImg, err := applyPipeline(ctx, pipeline, params, img, strategy, getPool())
+	timings(ctx).Filter = time.Since(start)
 	if err != nil {
-		return fmt.Errorf("erreur lors de la création du fichier de sortie : %w", err)
+		return fmt.Errorf("erreur lors du traitement de l'image : %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-	defer outputFile.Close()
 
-	switch outputPath[len(outputPath)-3:] {
-	case "jpg", "jpeg":
-		err = jpeg.Encode(outputFile, processedImg, nil)
-	case "png":
-		err = png.Encode(outputFile, processedImg)
+	start = time.Now()
+	switch format {
+	case shared.FormatJPEG:
+		err = jpeg.Encode(w, processedImg, nil)
+	case shared.FormatPNG:
+		err = png.Encode(w, processedImg)
+	case shared.FormatGIF:
+		err = gif.Encode(w, processedImg, nil)
 	default:
-		return fmt.Errorf("format de sortie non supporté : %s", outputPath)
+		return fmt.Errorf("%w en sortie : %q", ErrUnsupportedFormat, format)
 	}
 	if err != nil {
 		return fmt.Errorf("erreur lors de l'encodage de l'image : %w", err)
 	}
+	encode := time.Since(start)
+	timings(ctx).Encode = encode
+	Logger(ctx).Debug("image encodée", "format", format, "duree", encode)
 
 	return nil
 }
 
-// applyFilterToImage applique le filtre en entrée à une image
-func applyFilterToImage(filterType int, img image.Image) (image.Image, error) {
-	// On convertit d'abord l'image en une matrice de pixels pour pouvoir agir dessus
-	matrix := imageToMatrix(img)
+// normalizeFormat met un nom de format sous la forme utilisée par le package image ("jpg" devient "jpeg")
+func normalizeFormat(format string) string {
+	format = strings.ToLower(strings.TrimPrefix(format, "."))
+	if format == "jpg" {
+		return shared.FormatJPEG
+	}
+	return format
+}
+
+// supportedOutputFormat indique si on sait encoder une image dans ce format
+func supportedOutputFormat(format string) bool {
+	for _, f := range shared.ImageFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyPipeline applique les filtres du pipeline, dans l'ordre, à une image déjà décodée
+// les convolutions sont calculées par le pool partagé (voir SetWorkers), selon la stratégie par défaut (voir SetStrategy)
+func ApplyPipeline(pipeline shared.Pipeline, img image.Image) (*image.RGBA, error) {
+	return ApplyPipelineWith(context.Background(), pipeline, img, shared.StrategyDefault, nil)
+}
+
+// ApplyPipelineWith applique les filtres du pipeline, dans l'ordre, à une image déjà décodée, en répartissant les convolutions
+// selon la stratégie donnée entre les goroutines du pool donné (le pool partagé s'il est nil).
+// L'image n'est convertie qu'une seule fois en un tampon de pixels : chaque filtre travaille directement sur le résultat du précédent.
+// L'annulation de ctx est vérifiée à chaque tuile (ou bande de lignes) : le pipeline s'arrête alors avec l'erreur du contexte
+func ApplyPipelineWith(ctx context.Context, pipeline shared.Pipeline, img image.Image, strategy shared.Strategy, pool *WorkerPool) (*image.RGBA, error) {
+	strategy, err := resolveStrategy(strategy)
+	if err != nil {
+		return nil, err
+	}
+	if pool == nil {
+		pool = getPool()
+	}
+	// On vérifie tous les filtres et leurs paramètres avant de faire le moindre calcul
+	params, err := resolvePipeline(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	return applyPipeline(ctx, pipeline, params, img, strategy, pool)
+}
+
+// resolvePipeline vérifie la longueur du pipeline, puis chacun de ses filtres, et renvoie leurs paramètres complétés
+// par les valeurs par défaut
+func resolvePipeline(pipeline shared.Pipeline) ([]map[string]float64, error) {
+	if len(pipeline) == 0 {
+		return nil, fmt.Errorf("%w : aucun filtre demandé", ErrInvalidPipeline)
+	}
+	if len(pipeline) > shared.MaxPipelineLength {
+		return nil, fmt.Errorf("%w : %d filtres demandés, %d au maximum", ErrInvalidPipeline, len(pipeline), shared.MaxPipelineLength)
+	}
+	params := make([]map[string]float64, len(pipeline))
+	for i, filter := range pipeline {
+		p, err := resolveParams(filter)
+		if err != nil && len(pipeline) > 1 {
+			return nil, fmt.Errorf("étape %d : %w", i+1, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		params[i] = p
+	}
+	return params, nil
+}
 
+// applyPipeline applique les filtres du pipeline, dont les paramètres params ont déjà été vérifiés par resolvePipeline,
+// selon une stratégie déjà résolue
+func applyPipeline(ctx context.Context, pipeline shared.Pipeline, params []map[string]float64, img image.Image, strategy shared.Strategy, pool *WorkerPool) (*image.RGBA, error) {
+	// On convertit d'abord l'image en un tampon de pixels RGBA pour pouvoir agir dessus
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	pixels := toRGBA(img)
+	run := cancellable(ctx, pool.tilingFor(strategy))
+	for i, filter := range pipeline {
+		start := time.Now()
+		if strategy == shared.StrategyCompare {
+			pixels = compareFilter(ctx, filter, params[i], pixels, pool)
+		} else {
+			pixels = applyFilterToPixels(filter, params[i], pixels, run)
+		}
+		// Un filtre interrompu laisse une image incomplète, qui ne doit pas servir au filtre suivant
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		Logger(ctx).Debug("filtre appliqué", "etape", i+1, "filtre", filter.String(), "strategie", strategy, "duree", time.Since(start))
+	}
+	return pixels, nil
+}
+
+// applyFilterToPixels applique un filtre, dont les paramètres ont déjà été vérifiés, à un tampon de pixels
+// les convolutions parcourent l'image avec run
+func applyFilterToPixels(filter shared.Filter, params map[string]float64, pixels *image.RGBA, run tiling) *image.RGBA {
 	// Définition du kernel qui sera utilisé en fonction du filtre sélectionné
+	// (pas de kernel pour les niveaux de gris : la conversion est directe)
 	var kernel [][]float64
-	switch filterType {
-	case 1:
-		kernel = [][]float64{ // Grayscale (dans ce cas pas de kernel, conversion directe)
-			{0.299, 0.587, 0.114},
-		}
-	case 2:
+	var separable *separableKernel
+	var boxRadius int
+	var bias float64
+	switch filter.Name {
+	case shared.FilterEdges:
 		kernel = [][]float64{ // Détection de contours
 			{-1, -1, -1},
 			{-1, 8, -1},
 			{-1, -1, -1},
 		}
-	case 3:
-		kernel = [][]float64{ // Netteté
-			{0, -1, 0},
-			{-1, 5, -1},
-			{0, -1, 0},
+	case shared.FilterSharpen:
+		kernel = sharpenKernel(params["intensite"])
+	case shared.FilterGaussianBlur:
+		gaussian := gaussianKernel(int(params["rayon"]), params["sigma"])
+		separable = &gaussian
+	case shared.FilterBoxBlur:
+		boxRadius = int(params["rayon"])
+	case shared.FilterCustomKernel:
+		kernel = scaleKernel(filter.Kernel, params["diviseur"])
+		bias = params["biais"]
+		// Un grand noyau de rang 1 (flou, relief...) est appliqué en deux passes, beaucoup plus rapides
+		if s, ok := separate(kernel); ok {
+			separable = &s
 		}
-	case 4:
-		kernel = [][]float64{ // Flou gaussien
-			{1 / 16.0, 2 / 16.0, 1 / 16.0},
-			{2 / 16.0, 4 / 16.0, 2 / 16.0},
-			{1 / 16.0, 2 / 16.0, 1 / 16.0},
-		}
-		//on met .0 pour avoir des floats car en go division de deux entiers donne entier
-	default:
-		return nil, fmt.Errorf("filtre non reconnu : %d", filterType)
 	}
 
-	// Application du kernel à la matrice de pixels
-	var outputMatrix [][][4]uint8
-	if filterType == 1 {
+	// Application du kernel au tampon de pixels
+	var output *image.RGBA
+	switch {
+	case filter.Name == shared.FilterGrayscale:
 		// Conversion directe en niveaux de gris
-		outputMatrix = applyGrayscale(matrix)
-	} else {
-		//outputMatrix = applyKernelParallel(matrix, kernel)
-		// Mesurer le temps pour la version séquentielle
-		startSequential := time.Now()
-		outputMatrix = applyKernelSequential(matrix, kernel)
-		//cette matrice en sortie ne sera pas utilisée car elle est remplacée par celle calculée séquentiellement
-		//sert tout de même pour le temps
-		elapsedSequential := time.Since(startSequential)
-		fmt.Printf("Temps d'exécution sans goroutines : %v\n", elapsedSequential)
-
-		// Mesurer le temps mis pour la version parallèle
-		startParallel := time.Now()
-		outputMatrix = applyKernelParallel(matrix, kernel)
-		elapsedParallel := time.Since(startParallel)
-		fmt.Printf("Temps d'exécution avec goroutines : %v\n", elapsedParallel)
-	}
-
-	// On reconvertit la matrice de pixels en image
-	return matrixToImage(outputMatrix), nil
+		output = applyGrayscale(pixels, run)
+	case separable != nil:
+		output = applySeparable(pixels, *separable, bias, run)
+	case boxRadius > 0:
+		output = applyBoxBlur(pixels, boxRadius, run)
+	default:
+		output = applyKernelTiled(pixels, kernel, bias, run)
+	}
+
+	// Pour les contours, on ne garde que ceux qui dépassent le seuil demandé
+	if filter.Name == shared.FilterEdges && params["seuil"] > 0 {
+		applyThreshold(output, params["seuil"])
+	}
+
+	return output
 }
 
-// imageToMatrix convertit une image en une matrice de pixels
-func imageToMatrix(img image.Image) [][][4]uint8 {
-	bounds := img.Bounds()
-	width, height := bounds.Dx(), bounds.Dy()
+// sharpenKernel construit le kernel de netteté pour une intensité donnée (une intensité de 1 donne le kernel classique, 0 laisse l'image inchangée)
+func sharpenKernel(amount float64) [][]float64 {
+	return [][]float64{
+		{0, -amount, 0},
+		{-amount, 1 + 4*amount, -amount},
+		{0, -amount, 0},
+	}
+}
 
-	matrix := make([][][4]uint8, height)
-	for y := 0; y < height; y++ {
-		matrix[y] = make([][4]uint8, width)
-		for x := 0; x < width; x++ {
-			r, g, b, a := img.At(x, y).RGBA()
-			matrix[y][x] = [4]uint8{
-				uint8(r >> 8),
-				uint8(g >> 8),
-				uint8(b >> 8),
-				uint8(a >> 8),
+// scaleKernel renvoie une copie du kernel fourni par le client, dont chaque coefficient est divisé par le diviseur
+// un diviseur nul est remplacé par la somme des coefficients (ou 1 si cette somme est nulle, comme pour la détection de contours)
+func scaleKernel(kernel [][]float64, divisor float64) [][]float64 {
+	if divisor == 0 {
+		for _, row := range kernel {
+			for _, v := range row {
+				divisor += v
 			}
 		}
+		if divisor == 0 {
+			divisor = 1
+		}
 	}
-	return matrix
-}
 
-// matrixToImage convertit une matrice de pixels en une image
-func matrixToImage(matrix [][][4]uint8) *image.RGBA {
-	height := len(matrix)
-	width := len(matrix[0])
-
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			pixel := matrix[y][x]
-			img.Set(x, y, color.RGBA{
-				R: pixel[0],
-				G: pixel[1],
-				B: pixel[2],
-				A: pixel[3],
-			})
+	scaled := make([][]float64, len(kernel))
+	for y, row := range kernel {
+		scaled[y] = make([]float64, len(row))
+		for x, v := range row {
+			scaled[y][x] = v / divisor
 		}
 	}
-	return img
+	return scaled
 }
 
-// applyGrayscale convertit une matrice de pixels en niveaux de gris $
-func applyGrayscale(matrix [][][4]uint8) [][][4]uint8 {
-	height := len(matrix)
-	width := len(matrix[0])
-
-	output := make([][][4]uint8, height)
+// applyThreshold met à noir les pixels dont l'intensité est inférieure au seuil
+func applyThreshold(pixels *image.RGBA, threshold float64) {
+	width, height := pixels.Rect.Dx(), pixels.Rect.Dy()
 	for y := 0; y < height; y++ {
-		output[y] = make([][4]uint8, width)
-		for x := 0; x < width; x++ {
-			pixel := matrix[y][x]
-			gray := uint8(0.299*float64(pixel[0]) + 0.587*float64(pixel[1]) + 0.114*float64(pixel[2]))
-			//on obtient les valeurs de gris en pondérant avec des coefficients connus la valeur des canaux r g et b (choix de ne pas moyenner pour ce filtre)
-			output[y][x] = [4]uint8{gray, gray, gray, pixel[3]}
+		row := pixels.Pix[y*pixels.Stride : y*pixels.Stride+4*width]
+		for i := 0; i < len(row); i += 4 {
+			if 0.299*float64(row[i])+0.587*float64(row[i+1])+0.114*float64(row[i+2]) < threshold {
+				row[i], row[i+1], row[i+2] = 0, 0, 0
+			}
 		}
 	}
-	return output
 }
 
-// applyKernelParallel applique un kernel à une matrice de pixels en parallèle, avec plusieurs goroutines qui gèrent chacune un bout de la matruce
-func applyKernelParallel(matrix [][][4]uint8, kernel [][]float64) [][][4]uint8 {
-	height := len(matrix)
-	width := len(matrix[0])
-
-	output := make([][][4]uint8, height)
-	for i := range output {
-		output[i] = make([][4]uint8, width)
+// toRGBA renvoie les pixels d'une image dans un tampon RGBA continu, d'origine (0, 0) :
+// les 4 canaux du pixel (x, y) se trouvent à partir de l'indice y*Stride + 4*x de Pix
+// les types d'images produits par les décodeurs (YCbCr pour le jpeg, RGBA, NRGBA ou Gray pour le png, Paletted pour le gif)
+// sont convertis par des chemins rapides, sans passer par l'interface color.Color pour chaque pixel
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	if rgba, ok := img.(*image.RGBA); ok && bounds.Min == (image.Point{}) {
+		return rgba // Déjà sous la bonne forme : aucune copie n'est nécessaire, les filtres ne modifient jamais leur entrée
 	}
 
-	var wg sync.WaitGroup
-	numWorkers := 4 // Nombre de goroutines
-	rowsPerWorker := height / numWorkers
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	if paletted, ok := img.(*image.Paletted); ok {
+		palettedToRGBA(rgba, paletted)
+		return rgba
+	}
+	// image/draw sait copier directement les RGBA, NRGBA, YCbCr, Gray et CMYK (et passe par At pour les autres types)
+	draw.Draw(rgba, rgba.Rect, img, bounds.Min, draw.Src)
+	return rgba
+}
 
-	worker := func(start, end int) {
-		defer wg.Done()
-		for y := start; y < end; y++ {
-			for x := 0; x < width; x++ {
-				output[y][x] = applyKernel(matrix, kernel, x, y)
-			}
+// palettedToRGBA convertit une image à palette (gif) en ne calculant qu'une fois la couleur de chaque entrée de la palette
+func palettedToRGBA(dst *image.RGBA, src *image.Paletted) {
+	palette := make([][4]uint8, 256)
+	for i, c := range src.Palette {
+		if i >= len(palette) {
+			break
 		}
+		r, g, b, a := c.RGBA()
+		palette[i] = [4]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
 	}
 
-	// Démarrage des goroutines
-	for i := 0; i < numWorkers; i++ {
-		start := i * rowsPerWorker
-		end := start + rowsPerWorker
-		if i == numWorkers-1 {
-			end = height
+	width, height := dst.Rect.Dx(), dst.Rect.Dy()
+	for y := 0; y < height; y++ {
+		in := src.Pix[y*src.Stride : y*src.Stride+width]
+		out := dst.Pix[y*dst.Stride : y*dst.Stride+4*width]
+		for x, index := range in {
+			copy(out[4*x:4*x+4], palette[index][:])
 		}
-		wg.Add(1)
-		go worker(start, end)
 	}
+}
 
-	wg.Wait()
+// applyGrayscale convertit un tampon de pixels en niveaux de gris, en le parcourant avec run
+func applyGrayscale(pixels *image.RGBA, run tiling) *image.RGBA {
+	output := image.NewRGBA(pixels.Rect)
+	run(pixels.Rect, func(tile image.Rectangle) {
+		for y := tile.Min.Y; y < tile.Max.Y; y++ {
+			in := pixels.Pix[y*pixels.Stride+4*tile.Min.X : y*pixels.Stride+4*tile.Max.X]
+			out := output.Pix[y*output.Stride+4*tile.Min.X : y*output.Stride+4*tile.Max.X]
+			for i := 0; i < len(in); i += 4 {
+				gray := uint8(0.299*float64(in[i]) + 0.587*float64(in[i+1]) + 0.114*float64(in[i+2]))
+				//on obtient les valeurs de gris en pondérant avec des coefficients connus la valeur des canaux r g et b (choix de ne pas moyenner pour ce filtre)
+				out[i], out[i+1], out[i+2], out[i+3] = gray, gray, gray, in[i+3]
+			}
+		}
+	})
 	return output
 }
 
-// applyKernelSequential applique un kernel à une matrice de pixels sans goroutines
-func applyKernelSequential(matrix [][][4]uint8, kernel [][]float64) [][][4]uint8 {
-	height := len(matrix)
-	width := len(matrix[0])
-
-	output := make([][][4]uint8, height)
-	for i := range output {
-		output[i] = make([][4]uint8, width)
-	}
+// applyKernelTiled applique un kernel à un tampon de pixels, en le parcourant avec run (d'un seul tenant, ou en tuiles
+// calculées en parallèle par les goroutines du pool partagé entre toutes les requêtes)
+func applyKernelTiled(pixels *image.RGBA, kernel [][]float64, bias float64, run tiling) *image.RGBA {
+	output := image.NewRGBA(pixels.Rect)
+	run(pixels.Rect, func(tile image.Rectangle) {
+		applyKernelRect(pixels, output, kernel, bias, tile)
+	})
+	return output
+}
 
-	// Appliquer le kernel sur toute la matrice sans goroutines
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			output[y][x] = applyKernel(matrix, kernel, x, y)
+// applyKernelRect applique un kernel aux pixels de src compris dans le rectangle r, et écrit le résultat dans dst
+func applyKernelRect(src, dst *image.RGBA, kernel [][]float64, bias float64, r image.Rectangle) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			applyKernel(src, dst, kernel, bias, x, y)
 		}
 	}
-
-	return output
 }
 
-// applyKernel applique un kernel à un pixel spécifique
-func applyKernel(matrix [][][4]uint8, kernel [][]float64, x, y int) [4]uint8 {
-	height := len(matrix)
-	width := len(matrix[0])
-	kernelSize := len(kernel)
-	offset := kernelSize / 2
+// applyKernel applique un kernel à un pixel spécifique de src, ajoute le biais à chaque canal et écrit le résultat dans dst
+func applyKernel(src, dst *image.RGBA, kernel [][]float64, bias float64, x, y int) {
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+	offset := len(kernel) / 2
 
 	var r, g, b float64
-	for ky := 0; ky < kernelSize; ky++ {
-		for kx := 0; kx < kernelSize; kx++ {
+	for ky, kernelRow := range kernel {
+		py := y + ky - offset
+		if py < 0 || py >= height {
+			continue
+		}
+		row := src.Pix[py*src.Stride : py*src.Stride+4*width]
+		for kx, k := range kernelRow {
 			px := x + kx - offset
-			py := y + ky - offset
-			if px >= 0 && px < width && py >= 0 && py < height {
-				pixel := matrix[py][px]
-				r += float64(pixel[0]) * kernel[ky][kx]
-				g += float64(pixel[1]) * kernel[ky][kx]
-				b += float64(pixel[2]) * kernel[ky][kx]
+			if px < 0 || px >= width {
+				continue
 			}
+			pixel := row[4*px : 4*px+4 : 4*px+4]
+			r += float64(pixel[0]) * k
+			g += float64(pixel[1]) * k
+			b += float64(pixel[2]) * k
 		}
 	}
 
-	// on limite les valeurs des pixels à l'intervalle 0 à 255
-	clamp := func(v float64) uint8 {
-		if v < 0 {
-			return 0
-		}
-		if v > 255 {
-			return 255
-		}
-		return uint8(v)
-	}
+	i := y*dst.Stride + 4*x
+	dst.Pix[i] = clamp(r + bias)
+	dst.Pix[i+1] = clamp(g + bias)
+	dst.Pix[i+2] = clamp(b + bias)
+	dst.Pix[i+3] = src.Pix[y*src.Stride+4*x+3]
+}
 
-	return [4]uint8{clamp(r), clamp(g), clamp(b), matrix[y][x][3]}
+// clamp limite la valeur d'un canal à l'intervalle 0 à 255
+func clamp(v float64) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
 }
@@ -0,0 +1,46 @@
+package filters
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+type (
+	loggerKey  struct{}
+	timingsKey struct{}
+)
+
+// WithLogger renvoie un contexte qui fait écrire les messages du package dans logger : le serveur y passe le logger
+// de la requête, pour que ces messages portent son identifiant. Sans lui, ils vont dans slog.Default()
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// Logger renvoie le logger transmis par WithLogger, ou slog.Default()
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Timings reçoit la durée de chaque étape de Process, quand le contexte en transmet un (voir WithTimings)
+type Timings struct {
+	Decode time.Duration // Décodage de l'image reçue
+	Filter time.Duration // Application des filtres du pipeline
+	Encode time.Duration // Encodage de l'image traitée
+}
+
+// WithTimings renvoie un contexte qui fait remplir t par Process
+func WithTimings(ctx context.Context, t *Timings) context.Context {
+	return context.WithValue(ctx, timingsKey{}, t)
+}
+
+// timings renvoie le Timings transmis par WithTimings, ou un Timings qui ne sera lu par personne
+func timings(ctx context.Context) *Timings {
+	if t, ok := ctx.Value(timingsKey{}).(*Timings); ok {
+		return t
+	}
+	return &Timings{}
+}
@@ -0,0 +1,79 @@
+package filters
+
+import (
+	"GO/shared"
+	"fmt"
+	"math"
+)
+
+// resolveParams vérifie que le filtre existe et que ses paramètres sont connus et dans les limites autorisées,
+// puis renvoie la valeur de chacun de ses paramètres (la valeur par défaut pour ceux qui n'ont pas été fournis)
+func resolveParams(filter shared.Filter) (map[string]float64, error) {
+	specs, ok := shared.FilterParams[filter.Name]
+	if !ok {
+		return nil, fmt.Errorf("%w : %q", ErrUnknownFilter, filter.Name)
+	}
+	if err := validateKernel(filter); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]float64, len(specs))
+	for _, spec := range specs {
+		values[spec.Name] = spec.Default
+	}
+
+	for name, value := range filter.Params {
+		spec, ok := findParam(specs, name)
+		if !ok {
+			return nil, fmt.Errorf("%w : le filtre %s n'accepte pas de paramètre %q", ErrInvalidParameter, filter.Name, name)
+		}
+		if math.IsNaN(value) || value < spec.Min || value > spec.Max {
+			return nil, fmt.Errorf("%w : %s doit être compris entre %g et %g pour le filtre %s (reçu %g)", ErrInvalidParameter, name, spec.Min, spec.Max, filter.Name, value)
+		}
+		if spec.Integer && value != math.Trunc(value) {
+			return nil, fmt.Errorf("%w : %s doit être un entier pour le filtre %s (reçu %g)", ErrInvalidParameter, name, filter.Name, value)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// findParam cherche la description d'un paramètre par son nom
+func findParam(specs []shared.ParamSpec, name string) (shared.ParamSpec, bool) {
+	for _, spec := range specs {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return shared.ParamSpec{}, false
+}
+
+// validateKernel vérifie qu'un noyau n'est fourni que pour le filtre qui l'utilise,
+// et qu'il est carré, de taille impaire, dans la limite de taille et sans valeur infinie ou NaN
+func validateKernel(filter shared.Filter) error {
+	if filter.Name != shared.FilterCustomKernel {
+		if filter.Kernel != nil {
+			return fmt.Errorf("%w : le filtre %s n'accepte pas de noyau", ErrInvalidParameter, filter.Name)
+		}
+		return nil
+	}
+
+	size := len(filter.Kernel)
+	if size == 0 {
+		return fmt.Errorf("%w : le filtre %s demande un noyau", ErrInvalidParameter, filter.Name)
+	}
+	if size%2 == 0 || size > shared.MaxKernelSize {
+		return fmt.Errorf("%w : le noyau doit avoir un nombre impair de lignes, au plus %d (reçu %d)", ErrInvalidParameter, shared.MaxKernelSize, size)
+	}
+	for y, row := range filter.Kernel {
+		if len(row) != size {
+			return fmt.Errorf("%w : le noyau doit être carré, la ligne %d a %d valeurs au lieu de %d", ErrInvalidParameter, y+1, len(row), size)
+		}
+		for _, v := range row {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("%w : valeur de noyau invalide à la ligne %d : %g", ErrInvalidParameter, y+1, v)
+			}
+		}
+	}
+	return nil
+}
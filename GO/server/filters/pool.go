@@ -0,0 +1,136 @@
+package filters
+
+import (
+	"context"
+	"image"
+	"runtime"
+	"sync"
+)
+
+// tileSize est le côté (en pixels) des tuiles qui découpent l'image lors d'une convolution parallèle :
+// une tuile de 128x128 pixels (64 Ko) et les lignes voisines lues par le kernel tiennent dans le cache du processeur
+const tileSize = 128
+
+// tiling parcourt un rectangle de l'image en appelant fn sur des morceaux qui le recouvrent, et rend la main quand tout est calculé :
+// sequentialTiling traite tout le rectangle d'un coup, forEachBand le découpe en bandes de lignes et forEachTile en tuiles,
+// calculées par les goroutines d'un pool (voir tilingFor)
+type tiling func(bounds image.Rectangle, fn func(tile image.Rectangle))
+
+// sequentialTiling traite tout le rectangle d'un seul tenant, dans la goroutine appelante
+func sequentialTiling(bounds image.Rectangle, fn func(tile image.Rectangle)) {
+	fn(bounds)
+}
+
+// cancellable renvoie un parcours qui fait le même travail que run, mais s'arrête dès que ctx est annulé :
+// les morceaux pas encore commencés sont sautés, et le résultat incomplet doit alors être abandonné.
+// Les morceaux de plus de tileSize lignes (toute l'image en séquentiel, une bande par goroutine) sont traités
+// par bandes de tileSize lignes, pour que l'annulation soit vérifiée régulièrement
+func cancellable(ctx context.Context, run tiling) tiling {
+	if ctx.Done() == nil {
+		return run // Contexte qui ne peut pas être annulé
+	}
+	return func(bounds image.Rectangle, fn func(tile image.Rectangle)) {
+		run(bounds, func(tile image.Rectangle) {
+			for y := tile.Min.Y; y < tile.Max.Y; y += tileSize {
+				if ctx.Err() != nil {
+					return
+				}
+				fn(image.Rect(tile.Min.X, y, tile.Max.X, y+tileSize).Intersect(tile))
+			}
+		})
+	}
+}
+
+// WorkerPool fait calculer les tuiles par un nombre fixe de goroutines, partagées par toutes les requêtes en cours :
+// on ne crée pas de goroutines pour chaque image, et plusieurs images filtrées en même temps se partagent les processeurs
+type WorkerPool struct {
+	tasks   chan func()
+	workers int
+}
+
+var (
+	poolWorkers = runtime.GOMAXPROCS(0) // Nombre de goroutines du pool partagé, modifiable avec SetWorkers
+	poolOnce    sync.Once
+	sharedPool  *WorkerPool
+)
+
+// SetWorkers fixe le nombre de goroutines qui calculent les convolutions en parallèle (GOMAXPROCS par défaut) ;
+// elle doit être appelée au démarrage, avant le premier filtrage
+func SetWorkers(n int) {
+	if n > 0 {
+		poolWorkers = n
+	}
+}
+
+// Workers renvoie le nombre de goroutines du pool partagé, qui calculent les convolutions en parallèle
+func Workers() int {
+	return getPool().Workers()
+}
+
+// getPool renvoie le pool partagé, en le démarrant au premier appel
+func getPool() *WorkerPool {
+	poolOnce.Do(func() {
+		sharedPool = NewWorkerPool(poolWorkers)
+	})
+	return sharedPool
+}
+
+// NewWorkerPool démarre un pool de workers goroutines (au moins une), à arrêter avec Close quand il ne sert plus ;
+// le serveur n'en a pas besoin : il utilise le pool partagé
+func NewWorkerPool(workers int) *WorkerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &WorkerPool{tasks: make(chan func(), 4*workers), workers: workers}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for task := range p.tasks {
+				task()
+			}
+		}()
+	}
+	return p
+}
+
+// Workers renvoie le nombre de goroutines du pool
+func (p *WorkerPool) Workers() int {
+	return p.workers
+}
+
+// Close arrête les goroutines du pool, une fois les tuiles en cours terminées ; le pool ne doit plus être utilisé ensuite
+func (p *WorkerPool) Close() {
+	close(p.tasks)
+}
+
+// forEachTile découpe un rectangle en tuiles, appelle fn sur chacune d'elles depuis les goroutines du pool,
+// et attend que toutes les tuiles aient été traitées
+func (p *WorkerPool) forEachTile(bounds image.Rectangle, fn func(tile image.Rectangle)) {
+	var wg sync.WaitGroup
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += tileSize {
+		for x := bounds.Min.X; x < bounds.Max.X; x += tileSize {
+			tile := image.Rect(x, y, x+tileSize, y+tileSize).Intersect(bounds)
+			wg.Add(1)
+			p.tasks <- func() {
+				defer wg.Done()
+				fn(tile)
+			}
+		}
+	}
+	wg.Wait()
+}
+
+// forEachBand découpe un rectangle en autant de bandes de lignes que le pool a de goroutines, appelle fn sur chacune d'elles
+// depuis les goroutines du pool, et attend que toutes les bandes aient été traitées
+func (p *WorkerPool) forEachBand(bounds image.Rectangle, fn func(band image.Rectangle)) {
+	rowsPerBand := (bounds.Dy() + p.workers - 1) / p.workers
+	var wg sync.WaitGroup
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += rowsPerBand {
+		band := image.Rect(bounds.Min.X, y, bounds.Max.X, y+rowsPerBand).Intersect(bounds)
+		wg.Add(1)
+		p.tasks <- func() {
+			defer wg.Done()
+			fn(band)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,248 @@
+package filters
+
+import (
+	"image"
+	"math"
+)
+
+// minSeparableSize est la taille à partir de laquelle un kernel séparable est appliqué en deux passes :
+// pour un kernel 3x3, les 9 multiplications de la convolution directe coûtent moins cher que le tampon intermédiaire
+const minSeparableSize = 5
+
+// separableKernel décrit un kernel qui s'écrit comme le produit d'une colonne et d'une ligne :
+// kernel[y][x] = vertical[y] * horizontal[x]. On peut alors l'appliquer en deux passes 1-D
+// (2*taille multiplications par pixel au lieu de taille²), ce qui rend abordables les grands rayons de flou.
+type separableKernel struct {
+	horizontal []float64
+	vertical   []float64
+}
+
+// gaussianKernel construit le kernel de flou gaussien normalisé de taille 2*radius+1, sous forme séparable
+// (la gaussienne 2-D est le produit de deux gaussiennes 1-D) ; si sigma vaut 0, il est déduit du rayon (avec la même formule qu'OpenCV)
+func gaussianKernel(radius int, sigma float64) separableKernel {
+	if sigma == 0 {
+		sigma = 0.3*float64(radius-1) + 0.8
+	}
+
+	kernel := make([]float64, 2*radius+1)
+	var sum float64
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+
+	// Normalisation pour que la somme des coefficients fasse 1 (l'image ne s'assombrit ni ne s'éclaircit)
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return separableKernel{horizontal: kernel, vertical: kernel}
+}
+
+// separate cherche à écrire un kernel carré comme le produit d'une colonne et d'une ligne (kernel de rang 1) :
+// toutes ses lignes doivent être proportionnelles à celle qui contient le plus grand coefficient
+func separate(kernel [][]float64) (separableKernel, bool) {
+	size := len(kernel)
+	if size < minSeparableSize {
+		return separableKernel{}, false
+	}
+
+	// Le plus grand coefficient (en valeur absolue) sert de pivot, pour limiter les erreurs d'arrondi
+	var pivotX, pivotY int
+	var largest float64
+	for y, row := range kernel {
+		for x, v := range row {
+			if math.Abs(v) > largest {
+				pivotX, pivotY, largest = x, y, math.Abs(v)
+			}
+		}
+	}
+	if largest == 0 {
+		return separableKernel{}, false
+	}
+
+	pivot := kernel[pivotY][pivotX]
+	s := separableKernel{horizontal: make([]float64, size), vertical: make([]float64, size)}
+	for i := 0; i < size; i++ {
+		s.vertical[i] = kernel[i][pivotX]
+		s.horizontal[i] = kernel[pivotY][i] / pivot
+	}
+
+	// On vérifie que le produit redonne bien le kernel d'origine, à une erreur d'arrondi près
+	tolerance := 1e-9 * largest
+	for y, row := range kernel {
+		for x, v := range row {
+			if math.Abs(s.vertical[y]*s.horizontal[x]-v) > tolerance {
+				return separableKernel{}, false
+			}
+		}
+	}
+	return s, true
+}
+
+// applySeparable applique un kernel séparable en deux passes : d'abord les lignes, dans un tampon intermédiaire en réels
+// (pour ne perdre ni les valeurs négatives ni les décimales), puis les colonnes de ce tampon, en ajoutant le biais à la fin.
+// Comme pour applyKernel, les pixels hors de l'image sont ignorés : le résultat est le même qu'avec la convolution directe.
+func applySeparable(pixels *image.RGBA, kernel separableKernel, bias float64, run tiling) *image.RGBA {
+	width := pixels.Rect.Dx()
+	rows := make([]float32, 3*width*pixels.Rect.Dy())
+	run(pixels.Rect, func(tile image.Rectangle) {
+		horizontalPass(pixels, rows, kernel.horizontal, tile)
+	})
+
+	output := image.NewRGBA(pixels.Rect)
+	run(pixels.Rect, func(tile image.Rectangle) {
+		verticalPass(rows, pixels, output, kernel.vertical, bias, tile)
+	})
+	return output
+}
+
+// horizontalPass applique un kernel 1-D à chaque ligne des pixels du rectangle tile, et range le résultat dans rows (3 canaux par pixel)
+func horizontalPass(src *image.RGBA, rows []float32, kernel []float64, tile image.Rectangle) {
+	width := src.Rect.Dx()
+	offset := len(kernel) / 2
+	for y := tile.Min.Y; y < tile.Max.Y; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+4*width]
+		for x := tile.Min.X; x < tile.Max.X; x++ {
+			var r, g, b float64
+			for i, k := range kernel {
+				px := x + i - offset
+				if px < 0 || px >= width {
+					continue
+				}
+				r += float64(row[4*px]) * k
+				g += float64(row[4*px+1]) * k
+				b += float64(row[4*px+2]) * k
+			}
+			j := 3 * (y*width + x)
+			rows[j], rows[j+1], rows[j+2] = float32(r), float32(g), float32(b)
+		}
+	}
+}
+
+// verticalPass applique un kernel 1-D à chaque colonne du tampon rows, dans le rectangle tile, et écrit le résultat dans dst
+// (l'opacité des pixels est reprise de src)
+func verticalPass(rows []float32, src, dst *image.RGBA, kernel []float64, bias float64, tile image.Rectangle) {
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+	offset := len(kernel) / 2
+	for y := tile.Min.Y; y < tile.Max.Y; y++ {
+		for x := tile.Min.X; x < tile.Max.X; x++ {
+			var r, g, b float64
+			for i, k := range kernel {
+				py := y + i - offset
+				if py < 0 || py >= height {
+					continue
+				}
+				j := 3 * (py*width + x)
+				r += float64(rows[j]) * k
+				g += float64(rows[j+1]) * k
+				b += float64(rows[j+2]) * k
+			}
+			i := y*dst.Stride + 4*x
+			dst.Pix[i] = clamp(r + bias)
+			dst.Pix[i+1] = clamp(g + bias)
+			dst.Pix[i+2] = clamp(b + bias)
+			dst.Pix[i+3] = src.Pix[y*src.Stride+4*x+3]
+		}
+	}
+}
+
+// applyBoxBlur remplace chaque pixel par la moyenne des pixels du carré de côté 2*radius+1 qui l'entoure
+// (seulement ceux qui sont dans l'image : les bords ne s'assombrissent pas).
+// Les deux passes utilisent une somme glissante : le coût par pixel ne dépend pas du rayon.
+func applyBoxBlur(pixels *image.RGBA, radius int, run tiling) *image.RGBA {
+	width := pixels.Rect.Dx()
+	sums := make([]uint32, 3*width*pixels.Rect.Dy())
+	run(pixels.Rect, func(tile image.Rectangle) {
+		boxHorizontalPass(pixels, sums, radius, tile)
+	})
+
+	output := image.NewRGBA(pixels.Rect)
+	run(pixels.Rect, func(tile image.Rectangle) {
+		boxVerticalPass(sums, pixels, output, radius, tile)
+	})
+	return output
+}
+
+// window renvoie les bornes (incluses) de la fenêtre de rayon radius centrée sur i, limitée à [0, size)
+func window(i, radius, size int) (int, int) {
+	first, last := i-radius, i+radius
+	if first < 0 {
+		first = 0
+	}
+	if last > size-1 {
+		last = size - 1
+	}
+	return first, last
+}
+
+// boxHorizontalPass range dans sums, pour chaque pixel du rectangle tile, la somme de chaque canal sur la fenêtre horizontale qui l'entoure
+func boxHorizontalPass(src *image.RGBA, sums []uint32, radius int, tile image.Rectangle) {
+	width := src.Rect.Dx()
+	for y := tile.Min.Y; y < tile.Max.Y; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+4*width]
+
+		// Somme sur la fenêtre du premier pixel de la tuile, puis on la fait glisser d'un pixel à chaque fois
+		var r, g, b uint32
+		first, last := window(tile.Min.X, radius, width)
+		for px := first; px <= last; px++ {
+			r, g, b = r+uint32(row[4*px]), g+uint32(row[4*px+1]), b+uint32(row[4*px+2])
+		}
+		for x := tile.Min.X; x < tile.Max.X; x++ {
+			j := 3 * (y*width + x)
+			sums[j], sums[j+1], sums[j+2] = r, g, b
+
+			if out := x - radius; out >= 0 {
+				r, g, b = r-uint32(row[4*out]), g-uint32(row[4*out+1]), b-uint32(row[4*out+2])
+			}
+			if in := x + radius + 1; in < width {
+				r, g, b = r+uint32(row[4*in]), g+uint32(row[4*in+1]), b+uint32(row[4*in+2])
+			}
+		}
+	}
+}
+
+// boxVerticalPass additionne les sommes horizontales sur la fenêtre verticale de chaque pixel du rectangle tile,
+// divise par le nombre de pixels de la fenêtre et écrit la moyenne dans dst (l'opacité des pixels est reprise de src)
+func boxVerticalPass(sums []uint32, src, dst *image.RGBA, radius int, tile image.Rectangle) {
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+
+	// Une somme glissante par colonne de la tuile, initialisée sur la fenêtre de la première ligne
+	columns := make([]uint32, 3*tile.Dx())
+	first, last := window(tile.Min.Y, radius, height)
+	for py := first; py <= last; py++ {
+		line := sums[3*(py*width+tile.Min.X) : 3*(py*width+tile.Max.X)]
+		for i, v := range line {
+			columns[i] += v
+		}
+	}
+
+	for y := tile.Min.Y; y < tile.Max.Y; y++ {
+		firstY, lastY := window(y, radius, height)
+		for x := tile.Min.X; x < tile.Max.X; x++ {
+			firstX, lastX := window(x, radius, width)
+			count := uint32((lastX - firstX + 1) * (lastY - firstY + 1))
+
+			c := columns[3*(x-tile.Min.X):]
+			i := y*dst.Stride + 4*x
+			dst.Pix[i] = uint8((c[0] + count/2) / count) // Arrondi à l'entier le plus proche
+			dst.Pix[i+1] = uint8((c[1] + count/2) / count)
+			dst.Pix[i+2] = uint8((c[2] + count/2) / count)
+			dst.Pix[i+3] = src.Pix[y*src.Stride+4*x+3]
+		}
+
+		// On fait glisser la fenêtre d'une ligne vers le bas
+		if out := y - radius; out >= 0 {
+			line := sums[3*(out*width+tile.Min.X) : 3*(out*width+tile.Max.X)]
+			for i, v := range line {
+				columns[i] -= v
+			}
+		}
+		if in := y + radius + 1; in < height {
+			line := sums[3*(in*width+tile.Min.X) : 3*(in*width+tile.Max.X)]
+			for i, v := range line {
+				columns[i] += v
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package filters
+
+import (
+	"GO/shared"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+)
+
+// defaultMaxPixels est le nombre de pixels au-delà duquel une image est refusée, modifiable avec SetMaxPixels :
+// une image de 100 mégapixels occupe déjà 400 Mo une fois décodée, et les filtres en allouent plusieurs copies
+const defaultMaxPixels = 100_000_000
+
+// maxPixels est le nombre maximal de pixels d'une image acceptée par Process et ProcessBytes
+var maxPixels = defaultMaxPixels
+
+// SetMaxPixels fixe le nombre maximal de pixels (largeur x hauteur) d'une image à filtrer ;
+// elle doit être appelée au démarrage, avant le premier filtrage
+func SetMaxPixels(n int) {
+	if n > 0 {
+		maxPixels = n
+	}
+}
+
+// CheckSize lit les dimensions d'une image encodée dans son en-tête, sans la décoder, et renvoie ErrImageTooLarge
+// si elle dépasse le nombre de pixels autorisé : un fichier de quelques Ko peut annoncer une image de plusieurs
+// milliards de pixels, qu'on ne doit surtout pas essayer de décoder
+func CheckSize(data []byte) error {
+	_, err := checkedConfig(bytes.NewReader(data))
+	return err
+}
+
+// checkedConfig lit l'en-tête d'une image et vérifie ses dimensions ; elle renvoie les octets lus,
+// pour que l'image puisse ensuite être décodée depuis le début
+func checkedConfig(r io.Reader) ([]byte, error) {
+	var header bytes.Buffer
+	cfg, format, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, fmt.Errorf("%w : contenu non reconnu (formats acceptés : %s)", ErrUnsupportedFormat, strings.Join(shared.ImageFormats, ", "))
+		}
+		return nil, fmt.Errorf("%w : %w", ErrInvalidImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, fmt.Errorf("%w : dimensions %dx%d", ErrInvalidImage, cfg.Width, cfg.Height)
+	}
+	if pixels := int64(cfg.Width) * int64(cfg.Height); pixels > int64(maxPixels) {
+		return nil, fmt.Errorf("%w : image %s de %dx%d pixels (%.1f mégapixels, au plus %.1f)",
+			ErrImageTooLarge, format, cfg.Width, cfg.Height, float64(pixels)/1e6, float64(maxPixels)/1e6)
+	}
+	return header.Bytes(), nil
+}
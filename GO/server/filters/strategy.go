@@ -0,0 +1,77 @@
+package filters
+
+import (
+	"GO/shared"
+	"context"
+	"fmt"
+	"image"
+	"strings"
+	"time"
+)
+
+// defaultStrategy est la stratégie utilisée quand la requête n'en demande pas, modifiable avec SetStrategy
+var defaultStrategy = shared.StrategyTiles
+
+// SetStrategy fixe la stratégie d'exécution utilisée quand la requête n'en demande pas (StrategyTiles par défaut) ;
+// elle doit être appelée au démarrage, avant le premier filtrage
+func SetStrategy(strategy shared.Strategy) error {
+	if strategy == shared.StrategyDefault {
+		return fmt.Errorf("%w : la stratégie par défaut ne peut pas être vide", ErrInvalidParameter)
+	}
+	strategy, err := resolveStrategy(strategy)
+	if err != nil {
+		return err
+	}
+	defaultStrategy = strategy
+	return nil
+}
+
+// resolveStrategy vérifie qu'une stratégie existe, et remplace la stratégie vide par celle par défaut
+func resolveStrategy(strategy shared.Strategy) (shared.Strategy, error) {
+	if strategy == shared.StrategyDefault {
+		return defaultStrategy, nil
+	}
+	for _, s := range shared.Strategies {
+		if s == strategy {
+			return strategy, nil
+		}
+	}
+	names := make([]string, len(shared.Strategies))
+	for i, s := range shared.Strategies {
+		names[i] = string(s)
+	}
+	return "", fmt.Errorf("%w : stratégie d'exécution inconnue %q (possibles : %s)", ErrInvalidParameter, strategy, strings.Join(names, ", "))
+}
+
+// tilingFor renvoie la manière de parcourir l'image qui correspond à une stratégie (sauf StrategyCompare, traitée par compareFilter)
+func (p *WorkerPool) tilingFor(strategy shared.Strategy) tiling {
+	switch strategy {
+	case shared.StrategySequential:
+		return sequentialTiling
+	case shared.StrategyRows:
+		return p.forEachBand
+	default:
+		return p.forEachTile
+	}
+}
+
+// compareFilter applique un filtre séquentiellement puis en tuiles sur le pool, affiche les deux temps d'exécution
+// et renvoie le résultat calculé en parallèle (les deux résultats sont identiques). Les deux calculs s'arrêtent si ctx est annulé
+func compareFilter(ctx context.Context, filter shared.Filter, params map[string]float64, pixels *image.RGBA, pool *WorkerPool) *image.RGBA {
+	// Mesurer le temps pour la version séquentielle
+	startSequential := time.Now()
+	applyFilterToPixels(filter, params, pixels, cancellable(ctx, sequentialTiling))
+	elapsedSequential := time.Since(startSequential)
+
+	// Mesurer le temps mis pour la version parallèle
+	startParallel := time.Now()
+	output := applyFilterToPixels(filter, params, pixels, cancellable(ctx, pool.forEachTile))
+	elapsedParallel := time.Since(startParallel)
+	if ctx.Err() != nil {
+		return output // Calculs interrompus : les temps ne veulent rien dire
+	}
+
+	Logger(ctx).Info("comparaison des stratégies", "filtre", filter.String(), "duree_sequentielle", elapsedSequential,
+		"duree_parallele", elapsedParallel, "goroutines", pool.Workers(), "acceleration", float64(elapsedSequential)/float64(elapsedParallel))
+	return output
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"GO/server/filters"
+	"GO/shared"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// erreurHTTP est le corps JSON renvoyé quand une requête HTTP échoue
+type erreurHTTP struct {
+	Status    int                  `json:"status"`
+	Categorie shared.ErrorCategory `json:"categorie"`
+	Message   string               `json:"message"`
+}
+
+// etatTravailHTTP est le corps JSON décrivant un travail asynchrone
+type etatTravailHTTP struct {
+	ID      string          `json:"id"`
+	Etat    shared.JobState `json:"etat"`
+	Message string          `json:"message,omitempty"`
+}
+
+// nouveauServeurHTTP construit le serveur HTTP qui expose les mêmes filtres que le serveur gob :
+//   - GET /filtres renvoie en JSON la liste des filtres et de leurs paramètres
+//   - POST /filtrer reçoit une image (corps brut ou formulaire multipart) et renvoie l'image filtrée
+//   - POST /travaux reçoit une image de la même façon, mais renvoie tout de suite l'identifiant du travail créé
+//   - GET /travaux/<id> renvoie l'état d'un travail, GET /travaux/<id>/resultat son image (?attendre=1 pour attendre la fin)
+//
+// Le contexte de chaque requête dérive de ctx : son annulation interrompt les filtrages en cours
+func nouveauServeurHTTP(ctx context.Context) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/filtres", gererListeFiltres)
+	mux.HandleFunc("/filtrer", gererFiltrageHTTP)
+	mux.HandleFunc("/travaux", gererSoumissionHTTP)
+	mux.HandleFunc("/travaux/", gererTravailHTTP)
+	return &http.Server{
+		Addr:         config.AdresseHTTP,
+		Handler:      autoriserCORS(authentifierHTTP(mux)),
+		ReadTimeout:  time.Duration(config.DelaiHTTP), // Un client trop lent ne bloque pas une goroutine indéfiniment
+		WriteTimeout: time.Duration(config.DelaiHTTP),
+		// Les en-têtes doivent arriver vite, et une connexion gardée ouverte entre deux requêtes finit par être fermée
+		ReadHeaderTimeout: time.Duration(config.DelaiLecture),
+		IdleTimeout:       time.Duration(config.DelaiInactivite),
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+}
+
+// autoriserCORS permet aux pages web servies depuis une autre origine (comme le front-end Elm) d'appeler l'API
+func autoriserCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// gererListeFiltres renvoie les filtres disponibles avec la description de leurs paramètres
+func gererListeFiltres(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		ecrireErreurHTTP(w, shared.Response{Status: http.StatusMethodNotAllowed, Category: shared.CategoryBadRequest, Message: "méthode non autorisée"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shared.FilterParams)
+}
+
+// gererFiltrageHTTP applique les filtres demandés à l'image reçue et renvoie l'image traitée, avec le Content-Type correspondant
+func gererFiltrageHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		ecrireErreurHTTP(w, shared.Response{Status: http.StatusMethodNotAllowed, Category: shared.CategoryBadRequest, Message: "méthode non autorisée"})
+		return
+	}
+
+	debut := time.Now()
+	client := clientHTTP(r)
+	log := journalHTTP(w, r, client)
+
+	r.Body = http.MaxBytesReader(w, r.Body, config.TailleMaxHTTP)
+	imgData, err := lireRequeteHTTP(r)
+	if err != nil {
+		log.Warn("Requête HTTP invalide", "erreur", err)
+		ecrireErreurHTTP(w, reponseErreur(0, err))
+		return
+	}
+	reception := time.Since(debut)
+	log.Debug("Image reçue", "image", imgData.Name, "octets", len(imgData.Data), "duree_reception", reception)
+
+	if err := limites.verifier(cleLimite(client, r.RemoteAddr), imgData.Data); err != nil {
+		log.Warn("Requête refusée", "erreur", err)
+		ecrireErreurHTTP(w, reponseErreur(0, err))
+		return
+	}
+
+	// Comme la réponse ne peut plus partir après DelaiHTTP, le filtrage s'arrête au même moment ; il s'arrête aussi
+	// si le client se déconnecte (net/http annule alors le contexte de la requête)
+	var etapes filters.Timings
+	ctx, annuler := context.WithTimeout(r.Context(), time.Duration(config.DelaiHTTP))
+	defer annuler()
+	ctx = filters.WithTimings(filters.WithLogger(ctx, log), &etapes)
+	processedImgData, err := filtrerAvecAdmission(ctx, imgData)
+	if err != nil && r.Context().Err() != nil && !connexions.enArret() {
+		log.Info("Client déconnecté pendant le traitement de la requête : traitement abandonné")
+		return
+	}
+	if err != nil {
+		log.Log(ctx, niveauEchec(err), "Échec du traitement de la requête", "erreur", err)
+		ecrireErreurHTTP(w, reponseErreur(0, err))
+		return
+	}
+
+	debutEnvoi := time.Now()
+	if ecrireImageHTTP(w, log, processedImgData) {
+		journaliserRequete(log, imgData, shared.Response{Status: shared.StatusOK}, reception, etapes, time.Since(debutEnvoi), time.Since(debut))
+	}
+}
+
+// gererSoumissionHTTP crée un travail asynchrone à partir de l'image reçue et renvoie son identifiant (202 Accepted)
+func gererSoumissionHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		ecrireErreurHTTP(w, shared.Response{Status: http.StatusMethodNotAllowed, Category: shared.CategoryBadRequest, Message: "méthode non autorisée"})
+		return
+	}
+
+	client := clientHTTP(r)
+	log := journalHTTP(w, r, client)
+	r.Body = http.MaxBytesReader(w, r.Body, config.TailleMaxHTTP)
+	imgData, err := lireRequeteHTTP(r)
+	if err != nil {
+		log.Warn("Requête HTTP invalide", "erreur", err)
+		ecrireErreurHTTP(w, reponseErreur(0, err))
+		return
+	}
+
+	if err := limites.verifier(cleLimite(client, r.RemoteAddr), imgData.Data); err != nil {
+		log.Warn("Requête refusée", "erreur", err)
+		ecrireErreurHTTP(w, reponseErreur(0, err))
+		return
+	}
+
+	t, err := travaux.soumettre(filters.WithLogger(r.Context(), log), client, imgData)
+	if err != nil {
+		log.Warn("Travail refusé", "erreur", err)
+		ecrireErreurHTTP(w, reponseErreur(0, err))
+		return
+	}
+	log.Info("Travail soumis", "travail", t.id, "image", imgData.Name, "octets", len(imgData.Data))
+
+	w.Header().Set("Location", "/travaux/"+t.id)
+	ecrireEtatHTTP(w, reponseStatut(0, t, http.StatusAccepted))
+}
+
+// gererTravailHTTP renvoie l'état (/travaux/<id>) ou le résultat (/travaux/<id>/resultat) d'un travail
+func gererTravailHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		ecrireErreurHTTP(w, shared.Response{Status: http.StatusMethodNotAllowed, Category: shared.CategoryBadRequest, Message: "méthode non autorisée"})
+		return
+	}
+
+	if err := limites.verifier(cleLimite(clientHTTP(r), r.RemoteAddr), nil); err != nil {
+		ecrireErreurHTTP(w, reponseErreur(0, err))
+		return
+	}
+
+	id, suite, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/travaux/"), "/")
+	if suite != "" && suite != "resultat" {
+		http.NotFound(w, r)
+		return
+	}
+	t, err := travaux.trouver(id, clientHTTP(r))
+	if err != nil {
+		ecrireErreurHTTP(w, reponseErreur(0, err))
+		return
+	}
+	if suite == "" {
+		ecrireEtatHTTP(w, reponseStatut(0, t, http.StatusOK))
+		return
+	}
+
+	if attendre, _ := strconv.ParseBool(r.URL.Query().Get("attendre")); attendre {
+		select {
+		case <-t.fini:
+		case <-r.Context().Done(): // Le client HTTP a abandonné
+			return
+		}
+	}
+	response := reponseTravail(0, t)
+	switch response.Status {
+	case shared.StatusOK:
+		ecrireImageHTTP(w, journalHTTP(w, r, t.client).With("travail", t.id), response.Image)
+	case shared.StatusAccepted:
+		ecrireEtatHTTP(w, response)
+	default:
+		ecrireErreurHTTP(w, response)
+	}
+}
+
+// journalHTTP crée le journal d'une requête HTTP, avec un nouvel identifiant de requête, également renvoyé
+// au client dans l'en-tête X-Request-Id pour qu'il puisse retrouver sa requête dans les journaux du serveur
+func journalHTTP(w http.ResponseWriter, r *http.Request, client string) *slog.Logger {
+	id := nouvelIdRequete()
+	w.Header().Set("X-Request-Id", id)
+	return journal.With("adresse", r.RemoteAddr, "client", client, "id_requete", id)
+}
+
+// ecrireImageHTTP renvoie une image traitée, avec le Content-Type correspondant à son format ; elle indique si l'envoi a réussi
+func ecrireImageHTTP(w http.ResponseWriter, log *slog.Logger, processedImgData shared.ImageData) bool {
+	w.Header().Set("Content-Type", http.DetectContentType(processedImgData.Data))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", "modifiee_"+processedImgData.Name))
+	w.Header().Set("Content-Length", strconv.Itoa(len(processedImgData.Data)))
+	if _, err := w.Write(processedImgData.Data); err != nil {
+		log.Error("Erreur lors de l'envoi de l'image traitée", "erreur", err)
+		return false
+	}
+	log.Debug("Image traitée envoyée", "image", processedImgData.Name, "octets", len(processedImgData.Data))
+	return true
+}
+
+// ecrireEtatHTTP renvoie l'état d'un travail au format JSON
+func ecrireEtatHTTP(w http.ResponseWriter, response shared.Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(response.Status)
+	json.NewEncoder(w).Encode(etatTravailHTTP{ID: response.JobID, Etat: response.JobState, Message: response.Message})
+}
+
+// lireRequeteHTTP construit un ImageData à partir d'une requête HTTP. L'image est :
+//   - soit le champ "image" d'un formulaire multipart (le nom du fichier est alors repris),
+//   - soit le corps brut de la requête, nommé par le paramètre "nom".
+//
+// Le format de l'image est reconnu d'après son contenu ; le paramètre "format" permet de choisir celui de l'image renvoyée.
+// Le paramètre "strategie" choisit la répartition des convolutions entre les goroutines du serveur (celle du serveur par défaut).
+// Les filtres sont décrits par le paramètre "pipeline" (syntaxe des clients, comme "gris+flou:rayon=3", ou tableau JSON de shared.Filter),
+// ou par le paramètre "filtre" donnant le nom d'un seul filtre, les autres paramètres de l'URL étant alors ses paramètres.
+func lireRequeteHTTP(r *http.Request) (shared.ImageData, error) {
+	var imgData shared.ImageData
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		var err error
+		if imgData.Data, imgData.Name, err = lireFormulaire(r); err != nil {
+			return imgData, err
+		}
+	} else {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return imgData, erreurLectureHTTP(err, fmt.Errorf("%w : lecture de l'image impossible (%v)", errRequeteInvalide, err))
+		}
+		imgData.Data = data
+		imgData.Name = r.URL.Query().Get("nom")
+	}
+	imgData.OutputFormat = r.FormValue("format")
+	imgData.Strategy = shared.Strategy(r.FormValue("strategie"))
+	if len(imgData.Data) == 0 {
+		return imgData, fmt.Errorf("%w : image vide", errRequeteInvalide)
+	}
+
+	pipeline, err := pipelineHTTP(r)
+	if err != nil {
+		return imgData, err
+	}
+	imgData.Pipeline = pipeline
+	return imgData, nil
+}
+
+// lireFormulaire lit en mémoire le formulaire multipart de la requête et renvoie le contenu et le nom du fichier
+// de son champ "image" ; les autres champs sont ajoutés à r.Form, à la suite des paramètres de l'URL.
+// Contrairement à r.FormFile, qui passe par ParseMultipartForm, rien n'est écrit sur le disque : le corps est déjà
+// borné par http.MaxBytesReader.
+func lireFormulaire(r *http.Request) ([]byte, string, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, "", fmt.Errorf("%w : paramètres illisibles (%v)", errRequeteInvalide, err)
+	}
+	lecteur, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", fmt.Errorf("%w : formulaire illisible (%v)", errRequeteInvalide, err)
+	}
+
+	var data []byte
+	var nom string
+	trouve := false
+	for {
+		part, err := lecteur.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", erreurLectureHTTP(err, fmt.Errorf("%w : formulaire illisible (%v)", errRequeteInvalide, err))
+		}
+		contenu, err := io.ReadAll(part)
+		part.Close()
+		if err != nil {
+			return nil, "", erreurLectureHTTP(err, fmt.Errorf("%w : lecture du champ %q impossible (%v)", errRequeteInvalide, part.FormName(), err))
+		}
+		switch {
+		case part.FormName() == "image" && !trouve:
+			data, nom, trouve = contenu, part.FileName(), true
+		case part.FileName() == "":
+			r.Form.Add(part.FormName(), string(contenu))
+		}
+	}
+	if !trouve {
+		return nil, "", fmt.Errorf("%w : champ \"image\" absent du formulaire", errRequeteInvalide)
+	}
+	return data, nom, nil
+}
+
+// erreurLectureHTTP renvoie errTropVolumineux si la lecture du corps de la requête a échoué parce qu'il dépasse
+// la taille autorisée, et autre sinon
+func erreurLectureHTTP(err, autre error) error {
+	var tropGros *http.MaxBytesError
+	if errors.As(err, &tropGros) {
+		return fmt.Errorf("%w : corps de plus de %d octets", errTropVolumineux, tropGros.Limit)
+	}
+	return autre
+}
+
+// pipelineHTTP lit les filtres demandés dans les paramètres de la requête (URL ou formulaire)
+func pipelineHTTP(r *http.Request) (shared.Pipeline, error) {
+	if spec := r.FormValue("pipeline"); spec != "" {
+		if strings.HasPrefix(strings.TrimSpace(spec), "[") {
+			var pipeline shared.Pipeline
+			if err := json.Unmarshal([]byte(spec), &pipeline); err != nil {
+				return nil, fmt.Errorf("%w : pipeline JSON illisible (%v)", errRequeteInvalide, err)
+			}
+			return pipeline, nil
+		}
+		pipeline, err := shared.ParsePipeline(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%w : %v", errRequeteInvalide, err)
+		}
+		return pipeline, nil
+	}
+
+	query := r.URL.Query()
+	name := query.Get("filtre")
+	if name == "" {
+		return nil, fmt.Errorf("%w : paramètre \"filtre\" ou \"pipeline\" manquant", errRequeteInvalide)
+	}
+	filter := shared.Filter{Name: name}
+	for key, values := range query {
+		if key == "filtre" || key == "nom" || key == "format" || key == "strategie" {
+			continue
+		}
+		value, err := strconv.ParseFloat(values[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w : valeur invalide pour le paramètre %q : %q", errRequeteInvalide, key, values[0])
+		}
+		if filter.Params == nil {
+			filter.Params = make(map[string]float64)
+		}
+		filter.Params[key] = value
+	}
+	return shared.Pipeline{filter}, nil
+}
+
+// ecrireErreurHTTP renvoie une erreur au format JSON, avec le code de statut HTTP correspondant
+func ecrireErreurHTTP(w http.ResponseWriter, response shared.Response) {
+	if response.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(response.RetryAfter))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(response.Status)
+	json.NewEncoder(w).Encode(erreurHTTP{Status: response.Status, Categorie: response.Category, Message: response.Message})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"GO/server/filters"
+	"GO/shared"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// journal est le logger du serveur. Chaque message a un niveau et des attributs (client, adresse, identifiant de requête,
+// durées...) écrits sur la sortie d'erreur, en texte (clé=valeur) ou en JSON selon la configuration
+var journal = slog.Default()
+
+// Niveaux des messages : seuls ceux d'un niveau au moins égal à celui de la configuration sont affichés
+//   - debug : détail de chaque étape d'une requête (image reçue, filtres appliqués, réponse envoyée...)
+//   - info : démarrage, arrêt, connexions, requêtes traitées et travaux
+//   - avertissement : requêtes refusées (authentification, limites, délais, taille, filtres ou paramètres invalides, serveur occupé)
+//   - erreur : seulement les erreurs internes du serveur
+func lireNiveauLog(nom string) (slog.Level, error) {
+	switch nom {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "avertissement":
+		return slog.LevelWarn, nil
+	case "erreur":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("niveau de log inconnu %q (possibles : debug, info, avertissement, erreur)", nom)
+	}
+}
+
+// nouveauJournal crée le logger décrit par la configuration : format "texte" ou "json", et niveau minimal des messages
+func nouveauJournal(format, niveau string) (*slog.Logger, error) {
+	level, err := lireNiveauLog(niveau)
+	if err != nil {
+		return nil, err
+	}
+	options := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "texte":
+		return slog.New(slog.NewTextHandler(os.Stderr, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, options)), nil
+	default:
+		return nil, fmt.Errorf("format de log inconnu %q (possibles : texte, json)", format)
+	}
+}
+
+// nouvelIdRequete attribue à une requête (gob ou HTTP) un identifiant aléatoire, qui relie entre eux tous ses messages du journal,
+// jusque dans le package filters
+func nouvelIdRequete() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// niveauEchec renvoie le niveau auquel journaliser l'échec d'une requête : erreur seulement pour une erreur interne du serveur,
+// avertissement pour une requête refusée (filtre inconnu, paramètre invalide, format non supporté, serveur occupé...)
+func niveauEchec(err error) slog.Level {
+	if reponseErreur(0, err).Category == shared.CategoryInternal {
+		return slog.LevelError
+	}
+	return slog.LevelWarn
+}
+
+// journaliserRequete écrit la ligne de bilan d'une requête : son statut, ce qui a été demandé, et la durée de chaque étape
+// (réception, décodage, filtrage, encodage, envoi). Les étapes qui n'ont pas eu lieu (requête refusée, travail asynchrone...) sont omises
+func journaliserRequete(log *slog.Logger, imgData shared.ImageData, response shared.Response, reception time.Duration, etapes filters.Timings, envoi, total time.Duration) {
+	attrs := []any{"statut", response.Status}
+	if imgData.Action != "" {
+		attrs = append(attrs, "action", imgData.Action)
+	}
+	if len(imgData.Data) > 0 {
+		attrs = append(attrs, "image", imgData.Name, "octets", len(imgData.Data))
+		if pipeline, err := pipelineRequete(imgData); err == nil {
+			attrs = append(attrs, "filtres", pipeline.String())
+		}
+	}
+	if response.JobID != "" {
+		attrs = append(attrs, "travail", response.JobID)
+	}
+	attrs = append(attrs, "duree_reception", reception)
+	if etapes.Decode > 0 {
+		attrs = append(attrs, "duree_decodage", etapes.Decode)
+	}
+	if etapes.Filter > 0 {
+		attrs = append(attrs, "duree_filtrage", etapes.Filter)
+	}
+	if etapes.Encode > 0 {
+		attrs = append(attrs, "duree_encodage", etapes.Encode)
+	}
+	attrs = append(attrs, "duree_envoi", envoi, "duree_totale", total)
+	log.Info("Requête traitée", attrs...)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// erreurLimite signale qu'un client a dépassé son débit autorisé ou son quota du jour,
+// avec le délai après lequel sa requête serait acceptée
+type erreurLimite struct {
+	raison     string
+	retryAfter time.Duration
+}
+
+func (e *erreurLimite) Error() string {
+	return fmt.Sprintf("limite dépassée (%s), réessayez dans %d s", e.raison, secondes(e.retryAfter))
+}
+
+// seau est un seau à jetons : il se remplit à débit constant jusqu'à sa capacité, et chaque requête y puise selon son coût
+type seau struct {
+	jetons float64
+	maj    time.Time // Dernière mise à jour de jetons
+}
+
+// remplir ajoute les jetons accumulés depuis la dernière mise à jour
+func (s *seau) remplir(debit, capacite float64, maintenant time.Time) {
+	if s.maj.IsZero() {
+		s.jetons = capacite
+	} else {
+		s.jetons = math.Min(capacite, s.jetons+debit*maintenant.Sub(s.maj).Seconds())
+	}
+	s.maj = maintenant
+}
+
+// attente renvoie le temps qu'il faut attendre pour pouvoir puiser cout jetons (0 si c'est possible tout de suite).
+// Une requête plus coûteuse que la capacité du seau passe quand il est plein : le seau devient alors négatif,
+// et les requêtes suivantes attendent qu'il se remplisse de nouveau
+func (s *seau) attente(cout, debit, capacite float64) time.Duration {
+	manque := math.Min(cout, capacite) - s.jetons
+	if manque <= 0 {
+		return 0
+	}
+	return time.Duration(manque / debit * float64(time.Second))
+}
+
+// compteurClient regroupe les seaux et la consommation du jour d'un client
+type compteurClient struct {
+	requetes   seau // Requêtes par seconde
+	megapixels seau // Mégapixels par minute
+
+	jour           string // Date à laquelle se rapportent les compteurs suivants
+	requetesJour   int
+	megapixelsJour float64
+}
+
+// limiteur applique à chaque client les limites de débit et les quotas journaliers de la configuration.
+// Un client est désigné par le nom de son jeton quand l'authentification est active, sinon par son adresse IP
+type limiteur struct {
+	requetesParSeconde  float64
+	rafaleRequetes      float64
+	megapixelsParMinute float64
+	quotaRequetes       int
+	quotaMegapixels     float64
+
+	mu       sync.Mutex
+	compteur map[string]*compteurClient
+}
+
+// limites est le limiteur partagé par toutes les connexions (gob et HTTP), nil si aucune limite n'est configurée
+var limites *limiteur
+
+// nouveauLimiteur crée un limiteur à partir de la configuration, ou renvoie nil si toutes les limites sont désactivées (à 0)
+func nouveauLimiteur(c configuration) *limiteur {
+	if c.RequetesParSeconde <= 0 && c.MegapixelsParMinute <= 0 && c.QuotaRequetesJour <= 0 && c.QuotaMegapixelsJour <= 0 {
+		return nil
+	}
+	l := &limiteur{
+		requetesParSeconde:  c.RequetesParSeconde,
+		rafaleRequetes:      float64(c.RafaleRequetes),
+		megapixelsParMinute: c.MegapixelsParMinute,
+		quotaRequetes:       c.QuotaRequetesJour,
+		quotaMegapixels:     c.QuotaMegapixelsJour,
+		compteur:            make(map[string]*compteurClient),
+	}
+	go l.nettoyer()
+	return l
+}
+
+// verifier compte une requête d'un client et renvoie une erreurLimite s'il a dépassé l'une de ses limites
+// (la requête refusée n'est alors pas décomptée). Les mégapixels et les quotas journaliers ne concernent
+// que les requêtes qui apportent une image à filtrer : consulter un travail ne coûte qu'une requête
+func (l *limiteur) verifier(cle string, data []byte) error {
+	if l == nil {
+		return nil
+	}
+	megapixels := 0.0
+	if len(data) > 0 {
+		megapixels = megapixelsImage(data)
+	}
+
+	maintenant := time.Now()
+	jour := maintenant.Format("2006-01-02")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c, ok := l.compteur[cle]
+	if !ok {
+		c = &compteurClient{}
+		l.compteur[cle] = c
+	}
+	if c.jour != jour {
+		c.jour, c.requetesJour, c.megapixelsJour = jour, 0, 0
+	}
+
+	// On vérifie toutes les limites avant de décompter quoi que ce soit
+	if l.requetesParSeconde > 0 {
+		c.requetes.remplir(l.requetesParSeconde, l.rafaleRequetes, maintenant)
+		if d := c.requetes.attente(1, l.requetesParSeconde, l.rafaleRequetes); d > 0 {
+			return &erreurLimite{raison: fmt.Sprintf("%g requête(s) par seconde", l.requetesParSeconde), retryAfter: d}
+		}
+	}
+	if len(data) > 0 {
+		if l.megapixelsParMinute > 0 {
+			debit := l.megapixelsParMinute / 60
+			c.megapixels.remplir(debit, l.megapixelsParMinute, maintenant)
+			if d := c.megapixels.attente(megapixels, debit, l.megapixelsParMinute); d > 0 {
+				return &erreurLimite{raison: fmt.Sprintf("%g mégapixels par minute", l.megapixelsParMinute), retryAfter: d}
+			}
+		}
+		demain := time.Date(maintenant.Year(), maintenant.Month(), maintenant.Day()+1, 0, 0, 0, 0, maintenant.Location())
+		if l.quotaRequetes > 0 && c.requetesJour >= l.quotaRequetes {
+			return &erreurLimite{raison: fmt.Sprintf("quota de %d requêtes par jour atteint", l.quotaRequetes), retryAfter: demain.Sub(maintenant)}
+		}
+		if l.quotaMegapixels > 0 && c.megapixelsJour+megapixels > l.quotaMegapixels {
+			return &erreurLimite{raison: fmt.Sprintf("quota de %g mégapixels par jour atteint", l.quotaMegapixels), retryAfter: demain.Sub(maintenant)}
+		}
+	}
+
+	if l.requetesParSeconde > 0 {
+		c.requetes.jetons--
+	}
+	if len(data) > 0 {
+		if l.megapixelsParMinute > 0 {
+			c.megapixels.jetons -= megapixels
+		}
+		c.requetesJour++
+		c.megapixelsJour += megapixels
+	}
+	return nil
+}
+
+// nettoyer oublie régulièrement les clients qu'on peut considérer comme nouveaux : leurs seaux sont de nouveau pleins,
+// et leurs quotas à zéro (le jour a changé depuis leur dernière requête, ou il n'y a pas de quotas)
+func (l *limiteur) nettoyer() {
+	sansQuota := l.quotaRequetes <= 0 && l.quotaMegapixels <= 0
+	for range time.Tick(time.Minute) {
+		maintenant := time.Now()
+		jour := maintenant.Format("2006-01-02")
+		l.mu.Lock()
+		for cle, c := range l.compteur {
+			if (sansQuota || c.jour != jour) && l.seauxPleins(c, maintenant) {
+				delete(l.compteur, cle)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// seauxPleins indique si les seaux d'un client se sont remplis depuis sa dernière requête (l.mu doit être verrouillé)
+func (l *limiteur) seauxPleins(c *compteurClient, maintenant time.Time) bool {
+	if l.requetesParSeconde > 0 {
+		c.requetes.remplir(l.requetesParSeconde, l.rafaleRequetes, maintenant)
+		if c.requetes.jetons < l.rafaleRequetes {
+			return false
+		}
+	}
+	if l.megapixelsParMinute > 0 {
+		c.megapixels.remplir(l.megapixelsParMinute/60, l.megapixelsParMinute, maintenant)
+		if c.megapixels.jetons < l.megapixelsParMinute {
+			return false
+		}
+	}
+	return true
+}
+
+// megapixelsImage lit les dimensions d'une image dans son en-tête, sans la décoder entièrement
+// (0 si l'en-tête est illisible : l'image sera de toute façon refusée par les filtres)
+func megapixelsImage(data []byte) float64 {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+	return float64(cfg.Width) * float64(cfg.Height) / 1e6
+}
+
+// cleLimite désigne un client pour le limiteur : le nom de son jeton s'il est authentifié, son adresse IP sinon
+// (plusieurs connexions d'une même machine partagent alors leurs limites)
+func cleLimite(client, adresse string) string {
+	if jetons != nil {
+		return client
+	}
+	if hote, _, err := net.SplitHostPort(adresse); err == nil {
+		return hote
+	}
+	return adresse
+}
@@ -4,147 +4,568 @@ import (
 	"GO/server/filters"
 	"GO/shared"
 	"context"
+	"crypto/tls"
 	"encoding/gob"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 )
 
-const portString = ":9000"
-
 var (
 	clientCounter int        // Compteur global pour les clients
 	clientMutex   sync.Mutex // Mutex pour protéger le compteur et éviter les race conditions (comme chaque client a accès au même compteur)
 )
 
+// errRequeteInvalide signale une requête mal formée (image absente, filtre ou action inconnus...)
+var errRequeteInvalide = errors.New("requête invalide")
+
 func init() {
 	gob.Register(shared.ImageData{})
+	gob.Register(shared.Response{})
 }
 
 func main() {
+	// Les réglages viennent du fichier de configuration, des variables d'environnement et de la ligne de commande
+	var err error
+	config, err = chargerConfiguration(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Println("Configuration invalide :", err)
+		os.Exit(2)
+	}
+	journal, _ = nouveauJournal(config.FormatLog, config.NiveauLog)
+	slog.SetDefault(journal) // Le package filters écrit aussi dans ce journal
+
+	// Avec un fichier de jetons, seuls les clients qui présentent l'un d'eux peuvent utiliser le serveur
+	if config.FichierJetons != "" {
+		if jetons, err = chargerJetons(config.FichierJetons); err != nil {
+			fmt.Println("Configuration invalide :", err)
+			os.Exit(2)
+		}
+		journal.Info("Authentification par jeton activée", "jetons", len(jetons.noms))
+	}
+
+	// Les convolutions de toutes les requêtes sont découpées en tuiles, calculées par un même ensemble de goroutines
+	filters.SetWorkers(config.Workers)
+	filters.SetMaxPixels(int(config.MegapixelsMax * 1e6))
+	if err := filters.SetStrategy(shared.Strategy(config.Strategie)); err != nil {
+		fmt.Println("Configuration invalide : -strategie :", err)
+		os.Exit(2)
+	}
+
 	// On crée un contexte annulable, qui permettra d'interrompre proprement le server
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Les filtrages ont leur propre contexte : à l'arrêt, ils ont encore -delai-arret pour se terminer avant d'être interrompus
+	ctxTravail, interrompreTravail := context.WithCancel(context.Background())
+	defer interrompreTravail()
+
 	// On gère les signaux d'arrêt (Ctrl+C)
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		<-sigChan // Attente d'un signal
-		fmt.Println("\nArrêt du serveur en cours...")
+		journal.Info("Arrêt du serveur en cours")
 		cancel() // Annulation du contexte
+
+		// Un second signal n'attend pas la fin des requêtes en cours
+		<-sigChan
+		journal.Error("Arrêt immédiat du serveur")
+		os.Exit(1)
 	}()
 
-	//Démarrage du serveur
-	ln, err := net.Listen("tcp", portString)
-	if err != nil {
-		fmt.Println("Erreur au démarrage du serveur :", err)
-		return
+	// Avec un certificat, les images et les jetons ne circulent plus en clair sur le réseau, ni en gob sur TCP ni en HTTP ;
+	// la socket Unix, locale, n'est pas chiffrée
+	var tlsConfig *tls.Config
+	if config.CertificatTLS != "" {
+		var err error
+		tlsConfig, err = configurationTLS(config.CertificatTLS, config.CleTLS, config.CAClientsTLS)
+		if err != nil {
+			journal.Error("Erreur au démarrage du serveur", "erreur", err)
+			os.Exit(1)
+		}
 	}
-	defer ln.Close()
-	fmt.Printf("Le serveur écoute sur %s...\n", portString)
-
-	var wg sync.WaitGroup
 
-	// On accepte les connexions dans une goroutine séparée
-	go func() {
-		for {
-			select {
-			case <-ctx.Done(): // Vérification de si le contexte est annulé
-				fmt.Println("Arrêt de l'acceptation de nouvelles connexions.")
-				return
-			default:
-				conn, err := ln.Accept()
-				if err != nil {
-					fmt.Println("Erreur lors de l'acceptation de la connexion :", err)
-					continue
-				}
-
-				wg.Add(1)
-				go func() {
-					defer wg.Done()
-					gererClient(conn)
-				}()
+	//Démarrage du serveur, sur TCP et/ou sur une socket Unix
+	var listeners []net.Listener
+	if config.Adresse != "" {
+		ln, err := net.Listen("tcp", config.Adresse)
+		if err != nil {
+			journal.Error("Erreur au démarrage du serveur", "erreur", err)
+			os.Exit(1)
+		}
+		protocole := "tcp"
+		if tlsConfig != nil {
+			ln = tls.NewListener(ln, tlsConfig)
+			protocole = "tcp, TLS"
+			if config.CAClientsTLS != "" {
+				protocole = "tcp, TLS mutuel"
 			}
 		}
-	}()
+		listeners = append(listeners, ln)
+		journal.Info("Le serveur écoute", "adresse", config.Adresse, "protocole", protocole)
+	}
+	if config.SocketUnix != "" {
+		ln, err := ecouterUnix(config.SocketUnix, fs.FileMode(config.PermissionsSocket))
+		if err != nil {
+			journal.Error("Erreur au démarrage du serveur", "erreur", err)
+			os.Exit(1)
+		}
+		listeners = append(listeners, ln) // La fermeture du listener supprime aussi le fichier de la socket
+		journal.Info("Le serveur écoute", "adresse", config.SocketUnix, "protocole", "unix", "permissions", config.PermissionsSocket)
+	}
+	journal.Info("Goroutines de calcul prêtes", "goroutines", filters.Workers(), "strategie", config.Strategie)
+
+	// Le nombre de filtrages simultanés est limité pour tout le serveur, quelle que soit l'origine de la requête
+	admission = nouveauControleAdmission(config.MaxFiltrages, config.MaxAttente)
+
+	// Chaque client (désigné par son jeton, ou à défaut par son adresse IP) a son propre débit et ses quotas
+	limites = nouveauLimiteur(config)
+
+	// Les travaux asynchrones sont traités en arrière-plan par un nombre limité de workers
+	travaux = nouvelleFileTravaux(ctx, ctxTravail, config.WorkersTravaux, config.CapaciteTravaux, time.Duration(config.DureeConservation))
+
+	// Le serveur HTTP tourne en parallèle du serveur gob, et utilise les mêmes filtres
+	var httpServer *http.Server
+	if config.AdresseHTTP != "" {
+		httpServer = nouveauServeurHTTP(ctxTravail)
+		protocole := "http"
+		if tlsConfig != nil {
+			httpServer.TLSConfig = tlsConfig.Clone()
+			protocole = "https"
+		}
+		go func() {
+			var err error
+			if httpServer.TLSConfig != nil {
+				err = httpServer.ListenAndServeTLS("", "") // Le certificat est déjà dans TLSConfig
+			} else {
+				err = httpServer.ListenAndServe()
+			}
+			if err != nil && err != http.ErrServerClosed {
+				journal.Error("Erreur du serveur HTTP", "erreur", err)
+			}
+		}()
+		journal.Info("Le serveur HTTP écoute", "adresse", config.AdresseHTTP, "protocole", protocole)
+	}
+
+	var wg, acceptation sync.WaitGroup
+
+	// On accepte les connexions de chaque adresse dans une goroutine séparée
+	for _, ln := range listeners {
+		acceptation.Add(1)
+		go func(ln net.Listener) {
+			defer acceptation.Done()
+			accepter(ctxTravail, ln, &wg)
+		}(ln)
+	}
 
 	// On attend que le contexte soit annulé
 	<-ctx.Done()
 
-	// On attend que toutes les goroutines clientes se terminent
-	fmt.Println("Attente de la fin des goroutines clientes...")
-	wg.Wait()
-	fmt.Println("Serveur arrêté.")
+	// Les adresses d'écoute sont fermées tout de suite : Accept rend la main, et les nouveaux clients sont refusés
+	for _, ln := range listeners {
+		ln.Close()
+	}
+	acceptation.Wait()
+
+	// Les sessions qui attendent leur prochaine requête sont fermées, les autres le seront après leur réponse ;
+	// les travaux pas encore commencés sont abandonnés
+	connexions.arreter()
+	if n := travaux.abandonner(); n > 0 {
+		journal.Info("Travaux en attente abandonnés", "travaux", n)
+	}
+
+	// Les requêtes en cours (gob, HTTP et travaux) ont -delai-arret pour se terminer
+	journal.Info("Attente de la fin des requêtes en cours", "delai_arret", time.Duration(config.DelaiArret))
+	ctxArret, annulerArret := context.WithTimeout(context.Background(), time.Duration(config.DelaiArret))
+	defer annulerArret()
+	var arretHTTP sync.WaitGroup
+	if httpServer != nil {
+		arretHTTP.Add(1)
+		go func() {
+			defer arretHTTP.Done()
+			if err := httpServer.Shutdown(ctxArret); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+				journal.Error("Erreur lors de l'arrêt du serveur HTTP", "erreur", err)
+			}
+		}()
+	}
+	if !attendreFin(ctxArret, &wg, &travaux.workers, &arretHTTP) {
+		// Passé ce délai, les filtrages en cours sont interrompus et les connexions restantes fermées de force
+		interrompreTravail()
+		n := connexions.fermer()
+		if httpServer != nil {
+			httpServer.Close()
+		}
+		journal.Warn("Délai d'arrêt dépassé : requêtes en cours interrompues", "delai_arret", time.Duration(config.DelaiArret), "connexions_fermees", n)
+	}
+	journal.Info("Serveur arrêté")
 }
 
-// fonction qui traite la demande d'un client
-func gererClient(conn net.Conn) {
-	defer conn.Close()
+// accepter accepte les connexions d'une adresse d'écoute et traite chacune dans sa propre goroutine, jusqu'à la fermeture
+// de l'adresse d'écoute par main ; ctx est le contexte des filtrages demandés sur ces connexions
+func accepter(ctx context.Context, ln net.Listener, wg *sync.WaitGroup) {
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			journal.Info("Arrêt de l'acceptation de nouvelles connexions", "adresse", ln.Addr().String())
+			return
+		}
+		if err != nil {
+			journal.Error("Erreur lors de l'acceptation de la connexion", "erreur", err)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gererClient(ctx, conn)
+		}()
+	}
+}
 
-	// On attribue un identifiant unique au client
+// nouvelIdentifiant attribue un nom unique à un client anonyme (connexion gob ou requête HTTP), quand l'authentification
+// est désactivée : "Client 0", "Client 1"... Les clients authentifiés sont désignés par le nom de leur jeton
+func nouvelIdentifiant() string {
 	clientMutex.Lock()
-	clientID := clientCounter
+	defer clientMutex.Unlock()
+	client := clientCounter
 	clientCounter++
-	clientMutex.Unlock()
+	return fmt.Sprintf("Client %d", client)
+}
 
-	fmt.Printf("Nouveau client connecté : Client %d\n", clientID)
+// fonction qui traite les demandes d'un client : la connexion reste ouverte tant que le client
+// envoie des requêtes, et se termine à la réception d'un message de fermeture (ou à la déconnexion du client, ou à l'arrêt du serveur).
+// Les filtrages de la session sont interrompus quand ctx est annulé
+func gererClient(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	d := &delaisConnexion{conn: conn}
+	if !connexions.ajouter(d) {
+		return // Le serveur s'arrête
+	}
+	defer connexions.retirer(d)
+	log := journal.With("adresse", adresseClient(conn))
 
-	// Création d'un répertoire temporaire pour ce client
-	clientDir, err := os.MkdirTemp("", fmt.Sprintf("client_%d_", clientID))
+	// En TLS, la poignée de main a lieu tout de suite, pour refuser au plus tôt un client sans certificat valide
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		identite, err := identiteTLS(tlsConn, time.Duration(config.DelaiLecture))
+		if err != nil {
+			log.Warn("Échec de la poignée de main TLS", "erreur", err)
+			return
+		}
+		log = log.With("tls", true)
+		if identite != "" {
+			log = log.With("certificat", identite)
+		}
+	}
+
+	// Le décodeur et l'encodeur sont conservés pour toute la session : gob n'envoie la description des types qu'une seule fois par flux
+	// La taille de chaque message est vérifiée avant que gob ne l'alloue, et son premier octet démarre le décompte des délais
+	lecteur := nouveauLecteurGob(conn, config.TailleMaxMessage)
+	lecteur.debutMessage = func() {
+		connexions.occuper(d)
+		d.debutMessage()
+	}
+	decoder := gob.NewDecoder(lecteur)
+	encoder := gob.NewEncoder(conn)
+
+	// Le client doit s'authentifier dès sa connexion, avant d'envoyer sa première image ;
+	// il est ensuite désigné par le nom de son jeton
+	if !connexions.attendre(d, time.Duration(config.DelaiLecture)) {
+		return
+	}
+	d.ecrire()
+	client, err := authentifierSession(decoder, encoder)
+	if estDelaiDepasse(err) && d.debut.IsZero() && connexions.enArret() {
+		log.Info("Connexion non authentifiée fermée pour l'arrêt du serveur")
+		return
+	}
+	if estDelaiDepasse(err) {
+		log.Warn("Délai dépassé pendant l'authentification : connexion fermée", "delai_lecture", time.Duration(config.DelaiLecture))
+		return
+	}
 	if err != nil {
-		fmt.Printf("Erreur lors de la création du répertoire temporaire pour le Client %d : %v\n", clientID, err)
+		log.Warn("Connexion refusée", "erreur", err)
+		if errors.Is(err, errTropVolumineux) {
+			fermerApresRefus(conn, lecteur)
+		}
 		return
 	}
-	defer os.RemoveAll(clientDir) //Une fois sa requête traité, le répertoire pourra être supprimé pour ne pas encombrer (quand tout sera fini)
-	fmt.Printf("Répertoire temporaire créé pour le Client %d : %s\n", clientID, clientDir)
+	log = log.With("client", client)
+	log.Info("Nouveau client connecté")
 
-	//Décodage de l'image envoyée par le client à l'aide de gob
-	var imgData shared.ImageData
-	decoder := gob.NewDecoder(conn)
-	if err := decoder.Decode(&imgData); err != nil {
-		fmt.Printf("Erreur lors du décodage de l'image du Client %d : %v\n", clientID, err)
-		return
+	for {
+		//Décodage de la prochaine requête envoyée par le client à l'aide de gob
+		if !connexions.attendre(d, time.Duration(config.DelaiInactivite)) {
+			log.Info("Session fermée pour l'arrêt du serveur")
+			return
+		}
+		var imgData shared.ImageData
+		if err := decoder.Decode(&imgData); err != nil {
+			switch {
+			case err == io.EOF:
+				log.Info("Client déconnecté")
+			case estDelaiDepasse(err) && d.debut.IsZero() && connexions.enArret():
+				log.Info("Session fermée pour l'arrêt du serveur")
+			case estDelaiDepasse(err) && d.debut.IsZero():
+				log.Info("Session fermée pour inactivité", "delai_inactivite", time.Duration(config.DelaiInactivite))
+			case estDelaiDepasse(err):
+				log.Warn("Délai dépassé pendant la réception de la requête : connexion fermée", "duree_reception", time.Since(d.debut))
+			case errors.Is(err, errTropVolumineux):
+				// Le reste du message n'est pas décodé : on prévient le client avant de fermer la connexion, désormais désynchronisée
+				log.Warn("Message refusé", "erreur", err)
+				d.ecrire()
+				encoder.Encode(reponseErreur(0, err))
+				fermerApresRefus(conn, lecteur)
+			default:
+				log.Error("Erreur lors du décodage de la requête", "erreur", err)
+			}
+			return
+		}
+		if imgData.Close {
+			log.Info("Connexion terminée")
+			return
+		}
+		reception := time.Since(d.debut)
+
+		// Tous les messages de la requête, jusque dans les filtres, portent son identifiant
+		logRequete := log.With("id_requete", nouvelIdRequete(), "requete", imgData.RequestID)
+		if imgData.Action == shared.ActionProcess || imgData.Action == shared.ActionSubmit {
+			logRequete.Debug("Image reçue", "image", imgData.Name, "octets", len(imgData.Data), "duree_reception", reception)
+		}
+
+		// Un client qui dépasse ses limites est prévenu tout de suite, plutôt que de voir ses requêtes s'accumuler dans la file
+		var response shared.Response
+		var etapes filters.Timings
+		if err := limites.verifier(cleLimite(client, adresseClient(conn)), imgData.Data); err != nil {
+			logRequete.Warn("Requête refusée", "erreur", err)
+			response = reponseErreur(imgData.RequestID, err)
+		} else {
+			// Le traitement s'arrête à la fin du délai total de la requête, ou dès que le client se déconnecte
+			ctxRequete, annuler := context.WithDeadline(ctx, d.debut.Add(time.Duration(config.DelaiRequete)))
+			ctxRequete = filters.WithTimings(filters.WithLogger(ctxRequete, logRequete), &etapes)
+			surveillance := surveillerDeconnexion(conn, lecteur, annuler)
+			response = traiterAction(ctxRequete, client, imgData)
+			deconnecte := surveillance.arreter()
+			annuler()
+			if deconnecte {
+				logRequete.Info("Client déconnecté pendant le traitement de la requête : traitement abandonné")
+				return
+			}
+		}
+
+		// Si le traitement a dépassé le délai total, le client n'attend plus ce résultat : on le remplace par l'erreur
+		if d.depasse() {
+			logRequete.Warn("Délai dépassé pendant le traitement de la requête", "image", imgData.Name, "duree", time.Since(d.debut))
+			response = reponseErreur(imgData.RequestID, fmt.Errorf("%w : la requête n'a pas été traitée en moins de %v", errDelaiDepasse, config.DelaiRequete))
+		}
+
+		//On envoie la réponse au client en l'encodant avec gob, avant de passer à la requête suivante
+		debutEnvoi := time.Now()
+		d.ecrire()
+		if err := encoder.Encode(response); err != nil {
+			if estDelaiDepasse(err) {
+				logRequete.Warn("Délai dépassé pendant l'envoi de la réponse : connexion fermée", "delai_ecriture", time.Duration(config.DelaiEcriture))
+			} else {
+				logRequete.Error("Erreur lors de l'envoi de la réponse", "erreur", err)
+			}
+			return
+		}
+		journaliserRequete(logRequete, imgData, response, reception, etapes, time.Since(debutEnvoi), time.Since(d.debut))
 	}
-	fmt.Printf("Image reçue du Client %d : %s\n", clientID, imgData.Name)
+}
 
-	inputPath := filepath.Join(clientDir, "input_"+imgData.Name)
-	if err := os.WriteFile(inputPath, imgData.Data, 0644); err != nil { //on écrit dans un fichier, avec les permission rw-r--r-- (644)
-		fmt.Printf("Erreur lors de la sauvegarde de l'image du Client %d : %v\n", clientID, err)
-		return
+// adresseClient décrit l'origine d'une connexion pour les journaux : l'adresse IP et le port du client,
+// ou "socket Unix" (les clients d'une socket Unix n'ont pas d'adresse)
+func adresseClient(conn net.Conn) string {
+	if conn.RemoteAddr().Network() == "unix" {
+		return "socket Unix"
 	}
-	fmt.Printf("Image sauvegardée pour le Client %d : %s\n", clientID, inputPath)
+	return conn.RemoteAddr().String()
+}
 
-	//On peut maintenant appliquer le filtre demandé à l'image reçue et l'enregistrer côté server dans outputPath
-	outputPath := filepath.Join(clientDir, "output_"+imgData.Name)
-	if err := filters.ApplyFilters(imgData.FilterType, inputPath, outputPath); err != nil {
-		fmt.Printf("Erreur lors du traitement de l'image du Client %d : %v\n", clientID, err)
-		return
+// nomAvecFormat adapte l'extension du nom d'une image au format dans lequel elle a été enregistrée
+// (photo.png convertie en jpeg devient photo.jpg ; une image sans nom s'appelle "image")
+func nomAvecFormat(name, format string) string {
+	name = filepath.Base(name)
+	if name == "." || name == string(filepath.Separator) {
+		name = "image"
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	switch {
+	case format == shared.FormatJPEG && (ext == ".jpg" || ext == ".jpeg"), ext == "."+format:
+		return name
+	case format == shared.FormatJPEG:
+		return strings.TrimSuffix(name, filepath.Ext(name)) + ".jpg"
+	default:
+		return strings.TrimSuffix(name, filepath.Ext(name)) + "." + format
 	}
-	fmt.Printf("Filtre appliqué pour le Client %d : %s\n", clientID, outputPath)
+}
 
-	//On lit ensuite l'image traitée
-	processedData, err := os.ReadFile(outputPath)
+// pipelineRequete renvoie la liste des filtres à appliquer pour une requête : le pipeline s'il est fourni, sinon le filtre seul
+// (les anciens clients désignent encore le filtre par son numéro plutôt que par son nom)
+func pipelineRequete(imgData shared.ImageData) (shared.Pipeline, error) {
+	if len(imgData.Pipeline) > 0 {
+		return imgData.Pipeline, nil
+	}
+	filter := imgData.Filter
+	if filter.Name == "" {
+		filter = shared.FilterFromType(imgData.FilterType)
+		if filter.Name == "" {
+			return nil, fmt.Errorf("%w : %d", filters.ErrUnknownFilter, imgData.FilterType)
+		}
+	}
+	return shared.Pipeline{filter}, nil
+}
+
+// reponseErreur construit la réponse décrivant une erreur de traitement, en déterminant sa catégorie à partir des erreurs du package filters
+func reponseErreur(requestID uint64, err error) shared.Response {
+	response := shared.Response{RequestID: requestID, Message: err.Error()}
+	var occupe *erreurOccupe
+	var limite *erreurLimite
+	switch {
+	case errors.Is(err, filters.ErrUnknownFilter):
+		response.Status, response.Category = shared.StatusBadRequest, shared.CategoryUnknownFilter
+	case errors.Is(err, errNonAuthentifie):
+		response.Status, response.Category = shared.StatusUnauthorized, shared.CategoryUnauthorized
+	case errors.Is(err, errTropVolumineux), errors.Is(err, filters.ErrImageTooLarge):
+		response.Status, response.Category = shared.StatusPayloadTooLarge, shared.CategoryTooLarge
+	case errors.Is(err, errDelaiDepasse):
+		response.Status, response.Category = shared.StatusGatewayTimeout, shared.CategoryTimeout
+	case errors.Is(err, context.DeadlineExceeded):
+		response.Status, response.Category, response.Message = shared.StatusGatewayTimeout, shared.CategoryTimeout, errDelaiDepasse.Error()
+	case errors.Is(err, errArret), errors.Is(err, context.Canceled):
+		response.Status, response.Category, response.Message = shared.StatusServiceUnavailable, shared.CategoryBusy, errArret.Error()
+	case errors.Is(err, errTravailInconnu):
+		response.Status, response.Category = shared.StatusNotFound, shared.CategoryUnknownJob
+	case errors.As(err, &limite):
+		response.Status, response.Category = shared.StatusTooManyRequests, shared.CategoryRateLimited
+		response.RetryAfter = secondes(limite.retryAfter)
+	case errors.As(err, &occupe):
+		response.Status, response.Category = shared.StatusServiceUnavailable, shared.CategoryBusy
+		response.RetryAfter = secondes(occupe.retryAfter)
+	case errors.Is(err, errRequeteInvalide), errors.Is(err, filters.ErrInvalidPipeline):
+		response.Status, response.Category = shared.StatusBadRequest, shared.CategoryBadRequest
+	case errors.Is(err, filters.ErrInvalidParameter):
+		response.Status, response.Category = shared.StatusBadRequest, shared.CategoryInvalidParameter
+	case errors.Is(err, filters.ErrInvalidImage):
+		response.Status, response.Category = shared.StatusUnprocessable, shared.CategoryInvalidImage
+	case errors.Is(err, filters.ErrUnsupportedFormat):
+		response.Status, response.Category = shared.StatusUnsupportedMediaType, shared.CategoryUnsupportedFormat
+	default:
+		response.Status, response.Category = shared.StatusInternalError, shared.CategoryInternal
+	}
+	return response
+}
+
+// traiterAction répond à une requête d'un client selon l'action demandée : traitement immédiat de l'image,
+// soumission d'un travail asynchrone, ou consultation d'un travail soumis auparavant (depuis n'importe quelle connexion)
+func traiterAction(ctx context.Context, client string, imgData shared.ImageData) shared.Response {
+	switch imgData.Action {
+	case shared.ActionProcess:
+		processedImgData, err := filtrerAvecAdmission(ctx, imgData)
+		if err != nil {
+			// L'erreur est renvoyée au client dans la réponse : la session peut continuer avec la requête suivante.
+			// Un traitement interrompu (délai, déconnexion ou arrêt du serveur) est signalé par l'appelant
+			if ctx.Err() == nil {
+				filters.Logger(ctx).Log(ctx, niveauEchec(err), "Échec du traitement de la requête", "erreur", err)
+			}
+			return reponseErreur(imgData.RequestID, err)
+		}
+		return shared.Response{RequestID: imgData.RequestID, Status: shared.StatusOK, Image: processedImgData}
+
+	case shared.ActionSubmit:
+		t, err := travaux.soumettre(ctx, client, imgData)
+		if err != nil {
+			filters.Logger(ctx).Warn("Travail refusé", "erreur", err)
+			return reponseErreur(imgData.RequestID, err)
+		}
+		filters.Logger(ctx).Info("Travail soumis", "travail", t.id, "image", imgData.Name)
+		return reponseStatut(imgData.RequestID, t, shared.StatusAccepted)
+
+	case shared.ActionStatus, shared.ActionFetch:
+		t, err := travaux.trouver(imgData.JobID, client)
+		if err != nil {
+			return reponseErreur(imgData.RequestID, err)
+		}
+		if imgData.Action == shared.ActionStatus {
+			return reponseStatut(imgData.RequestID, t, shared.StatusOK)
+		}
+		if imgData.Wait {
+			select {
+			case <-t.fini:
+			case <-ctx.Done():
+				return reponseErreur(imgData.RequestID, errArret)
+			}
+		}
+		return reponseTravail(imgData.RequestID, t)
+
+	default:
+		return reponseErreur(imgData.RequestID, fmt.Errorf("%w : action inconnue %q", errRequeteInvalide, imgData.Action))
+	}
+}
+
+// filtrerAvecAdmission attend qu'une place se libère auprès du contrôle d'admission avant d'appliquer les filtres à l'image
+// (et échoue tout de suite si trop de requêtes attendent déjà, ou dès que ctx est annulé)
+func filtrerAvecAdmission(ctx context.Context, imgData shared.ImageData) (shared.ImageData, error) {
+	// Une requête invalide (filtres, paramètres, format) ou une image aux dimensions trop grandes est refusée avant d'attendre son tour
+	if err := verifierRequete(imgData); err != nil {
+		return shared.ImageData{}, err
+	}
+	if err := admission.entrer(ctx); err != nil {
+		return shared.ImageData{}, err
+	}
+	defer admission.sortir(time.Now())
+	return traiterRequete(ctx, imgData)
+}
+
+// verifierRequete fait toutes les vérifications possibles sans décoder l'image : filtres demandés et leurs paramètres,
+// format de sortie, stratégie, et dimensions annoncées dans l'en-tête de l'image
+func verifierRequete(imgData shared.ImageData) error {
+	pipeline, err := pipelineRequete(imgData)
 	if err != nil {
-		fmt.Printf("Erreur lors de la lecture de l'image traitée pour le Client %d : %v\n", clientID, err)
-		return
+		return err
 	}
+	if err := filters.Validate(pipeline, imgData.OutputFormat, imgData.Strategy); err != nil {
+		return err
+	}
+	return filters.CheckSize(imgData.Data)
+}
 
-	processedImgData := shared.ImageData{
-		Name: imgData.Name,
-		Data: processedData,
+// traiterRequete applique le filtre demandé à une image reçue et renvoie l'image traitée, prête à être envoyée au client
+// (tout le traitement se fait en mémoire : aucun fichier n'est écrit sur le disque du serveur).
+// Les messages des filtres vont dans le journal de la requête, transmis par ctx (voir filters.WithLogger)
+func traiterRequete(ctx context.Context, imgData shared.ImageData) (shared.ImageData, error) {
+	pipeline, err := pipelineRequete(imgData)
+	if err != nil {
+		return shared.ImageData{}, err
 	}
 
-	//On envoie finalement l'image traitée au client en l'encodant avec gob
-	encoder := gob.NewEncoder(conn)
-	if err := encoder.Encode(processedImgData); err != nil {
-		fmt.Printf("Erreur lors de l'envoi de l'image traitée au Client %d : %v\n", clientID, err)
-		return
+	//On peut maintenant appliquer les filtres demandés à l'image reçue
+	processedData, format, err := filters.ProcessBytes(ctx, imgData.Data, pipeline, imgData.OutputFormat, imgData.Strategy)
+	if err != nil {
+		return shared.ImageData{}, err
 	}
-	fmt.Printf("Image traitée envoyée au Client %d : %s\n", clientID, imgData.Name)
-	fmt.Printf("Connexion du Client %d terminée.\n", clientID)
+	filters.Logger(ctx).Debug("Filtres appliqués", "filtres", pipeline.String(), "image", imgData.Name, "format", format, "octets", len(processedData))
+
+	return shared.ImageData{
+		Name:         nomAvecFormat(imgData.Name, format),
+		Data:         processedData,
+		OutputFormat: format,
+		RequestID:    imgData.RequestID,
+	}, nil
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// errTropVolumineux est renvoyée quand un message gob ou le corps d'une requête HTTP dépasse la taille autorisée
+var errTropVolumineux = errors.New("requête trop volumineuse")
+
+// lecteurGob laisse passer le flux gob d'une connexion, en vérifiant la longueur annoncée de chaque message
+// avant que le décodeur ne la lise : gob.Decoder alloue d'un coup la taille annoncée, qu'un client malveillant
+// peut fixer à plusieurs Go en n'envoyant que quelques octets
+type lecteurGob struct {
+	r       *bufio.Reader
+	max     int64  // Longueur maximale d'un message, en octets
+	entete  []byte // Octets de la longueur du message en cours, pas encore transmis au décodeur
+	restant int64  // Octets du message en cours pas encore transmis au décodeur
+	refuse  int64  // Longueur annoncée du dernier message refusé, qui n'a pas été lu
+
+	debutMessage func() // Appelée, si elle n'est pas nil, dès le premier octet de chaque message
+}
+
+// nouveauLecteurGob limite à max octets chacun des messages gob lus depuis r
+func nouveauLecteurGob(r io.Reader, max int64) *lecteurGob {
+	return &lecteurGob{r: bufio.NewReader(r), max: max}
+}
+
+func (l *lecteurGob) Read(p []byte) (int, error) {
+	if len(l.entete) == 0 && l.restant == 0 {
+		if err := l.lireEntete(); err != nil {
+			return 0, err
+		}
+	}
+	if len(l.entete) > 0 {
+		n := copy(p, l.entete)
+		l.entete = l.entete[n:]
+		return n, nil
+	}
+	if int64(len(p)) > l.restant {
+		p = p[:l.restant]
+	}
+	n, err := l.r.Read(p)
+	l.restant -= int64(n)
+	return n, err
+}
+
+// lireEntete lit la longueur du message suivant, codée comme un entier non signé gob : sur un octet si elle est
+// inférieure à 128, sinon un octet donnant l'opposé du nombre d'octets qui suivent, puis la valeur en big-endian
+func (l *lecteurGob) lireEntete() error {
+	premier, err := l.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if l.debutMessage != nil {
+		l.debutMessage()
+	}
+	l.entete = append(l.entete[:0], premier)
+	longueur := uint64(premier)
+	if premier >= 0x80 {
+		nbOctets := -int(int8(premier))
+		if nbOctets > 8 {
+			return fmt.Errorf("%w : longueur de message gob invalide", errTropVolumineux)
+		}
+		longueur = 0
+		for i := 0; i < nbOctets; i++ {
+			b, err := l.r.ReadByte()
+			if err != nil {
+				return err
+			}
+			l.entete = append(l.entete, b)
+			longueur = longueur<<8 | uint64(b)
+		}
+	}
+	if longueur > uint64(l.max) {
+		l.refuse = int64(min(longueur, uint64(vidageMax)))
+		return fmt.Errorf("%w : message de %d octets (au plus %d)", errTropVolumineux, longueur, l.max)
+	}
+	l.restant = int64(longueur)
+	return nil
+}
+
+// Après un message refusé, le serveur lit et jette au plus vidageMax octets de sa suite, pendant au plus delaiVidage
+const (
+	vidageMax   = 1 << 30
+	delaiVidage = 10 * time.Second
+)
+
+// fermerApresRefus prépare la fermeture d'une connexion dont un message trop volumineux a été refusé, une fois la réponse
+// d'erreur envoyée. Si le serveur fermait la connexion sans lire la suite du message, le système enverrait un RST au client,
+// qui perdrait la réponse avant de l'avoir lue. Comme net/http, on ferme donc d'abord le sens serveur vers client,
+// puis on jette ce que le client continue d'envoyer, dans la limite de la longueur annoncée, de vidageMax octets et de delaiVidage
+func fermerApresRefus(conn net.Conn, lecteur *lecteurGob) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		c.CloseWrite()
+	}
+	conn.SetReadDeadline(time.Now().Add(delaiVidage))
+	io.CopyN(io.Discard, lecteur.r, lecteur.refuse)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"GO/shared"
+	"crypto/tls"
+	"fmt"
+	"time"
+)
+
+// configurationTLS prépare la configuration TLS du serveur gob à partir de son certificat et de sa clé.
+// Si caClients n'est pas vide, chaque client doit présenter un certificat signé par l'une de ces autorités (TLS mutuel)
+func configurationTLS(cert, cle, caClients string) (*tls.Config, error) {
+	certificat, err := tls.LoadX509KeyPair(cert, cle)
+	if err != nil {
+		return nil, fmt.Errorf("certificat du serveur : %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificat},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if caClients != "" {
+		pool, err := shared.LoadCertPool(caClients)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// identiteTLS termine la poignée de main TLS d'une connexion, en laissant au client au plus delai pour le faire,
+// et décrit le client : le nom de son certificat en TLS mutuel, une chaîne vide sinon
+func identiteTLS(conn *tls.Conn, delai time.Duration) (string, error) {
+	conn.SetDeadline(time.Now().Add(delai))
+	if err := conn.Handshake(); err != nil {
+		if estDelaiDepasse(err) {
+			return "", fmt.Errorf("poignée de main non terminée en %v : %w", delai, err)
+		}
+		return "", err
+	}
+	conn.SetDeadline(time.Time{})
+	if certs := conn.ConnectionState().PeerCertificates; len(certs) > 0 {
+		return certs[0].Subject.CommonName, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// certificatTest est un certificat généré en mémoire pour les tests, avec sa clé
+type certificatTest struct {
+	cert *x509.Certificate
+	cle  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// genererCertificat crée un certificat pour nom, signé par parent (auto-signé si parent est nil)
+func genererCertificat(t *testing.T, nom string, parent *certificatTest, modifier func(*x509.Certificate)) *certificatTest {
+	t.Helper()
+	cle, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serie, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modele := &x509.Certificate{
+		SerialNumber: serie,
+		Subject:      pkix.Name{CommonName: nom},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	modifier(modele)
+	signataire, cleSignataire := modele, cle
+	if parent != nil {
+		signataire, cleSignataire = parent.cert, parent.cle
+	}
+	der, err := x509.CreateCertificate(rand.Reader, modele, signataire, &cle.PublicKey, cleSignataire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &certificatTest{cert: cert, cle: cle, der: der}
+}
+
+func genererCA(t *testing.T, nom string) *certificatTest {
+	return genererCertificat(t, nom, nil, func(c *x509.Certificate) {
+		c.IsCA = true
+		c.BasicConstraintsValid = true
+		c.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	})
+}
+
+func genererClient(t *testing.T, nom string, ca *certificatTest) *certificatTest {
+	return genererCertificat(t, nom, ca, func(c *x509.Certificate) {
+		c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	})
+}
+
+// ecrire enregistre le certificat et sa clé au format PEM dans dossier, et renvoie leurs chemins
+func (c *certificatTest) ecrire(t *testing.T, dossier, nom string) (string, string) {
+	t.Helper()
+	cleDER, err := x509.MarshalECPrivateKey(c.cle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, cle := filepath.Join(dossier, nom+".pem"), filepath.Join(dossier, nom+"-cle.pem")
+	if err := os.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cle, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: cleDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return cert, cle
+}
+
+// tls renvoie le certificat sous la forme attendue par tls.Config
+func (c *certificatTest) tls() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.cle, Leaf: c.cert}
+}
+
+// poigneeDeMain connecte un client TLS au serveur configuré par config, et renvoie le résultat de identiteTLS côté serveur
+func poigneeDeMain(t *testing.T, config *tls.Config, client *tls.Config) (string, error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), client)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Read(make([]byte, 1)) // En TLS 1.3, le refus du certificat du client n'arrive qu'après sa poignée de main
+	}()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return identiteTLS(tls.Server(conn, config), 5*time.Second)
+}
+
+func TestIdentiteTLS(t *testing.T) {
+	dossier := t.TempDir()
+	ca := genererCA(t, "Autorité de test")
+	serveur := genererCertificat(t, "localhost", ca, func(c *x509.Certificate) {
+		c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		c.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	})
+	autreCA := genererCA(t, "Autre autorité")
+
+	caPEM, _ := ca.ecrire(t, dossier, "ca")
+	certServeur, cleServeur := serveur.ecrire(t, dossier, "serveur")
+	racines := x509.NewCertPool()
+	racines.AddCert(ca.cert)
+
+	mutuel, err := configurationTLS(certServeur, cleServeur, caPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	simple, err := configurationTLS(certServeur, cleServeur, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		nom      string
+		config   *tls.Config
+		client   []tls.Certificate
+		identite string
+		refuse   bool
+	}{
+		{nom: "TLS mutuel, certificat valide", config: mutuel, client: []tls.Certificate{genererClient(t, "alice", ca).tls()}, identite: "alice"},
+		{nom: "TLS mutuel, sans certificat", config: mutuel, refuse: true},
+		{nom: "TLS mutuel, autorité inconnue", config: mutuel, client: []tls.Certificate{genererClient(t, "mallory", autreCA).tls()}, refuse: true},
+		{nom: "TLS simple, sans certificat", config: simple},
+	}
+	for _, tt := range tests {
+		t.Run(tt.nom, func(t *testing.T) {
+			identite, err := poigneeDeMain(t, tt.config, &tls.Config{RootCAs: racines, ServerName: "127.0.0.1", Certificates: tt.client})
+			if tt.refuse {
+				if err == nil {
+					t.Fatalf("poignée de main acceptée (identité %q), refus attendu", identite)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("poignée de main refusée : %v", err)
+			}
+			if identite != tt.identite {
+				t.Fatalf("identité %q, %q attendue", identite, tt.identite)
+			}
+		})
+	}
+}
+
+func TestConfigurationTLSInvalide(t *testing.T) {
+	dossier := t.TempDir()
+	ca := genererCA(t, "Autorité de test")
+	cert, cle := ca.ecrire(t, dossier, "ca")
+
+	if _, err := configurationTLS(filepath.Join(dossier, "absent.pem"), cle, ""); err == nil {
+		t.Error("certificat absent accepté")
+	}
+	if _, err := configurationTLS(cert, cle, filepath.Join(dossier, "absent.pem")); err == nil {
+		t.Error("fichier d'autorités absent accepté")
+	}
+	if _, err := configurationTLS(cert, cle, cle); err == nil {
+		t.Error("fichier d'autorités sans certificat accepté")
+	}
+}
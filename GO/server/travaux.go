@@ -0,0 +1,232 @@
+package main
+
+import (
+	"GO/server/filters"
+	"GO/shared"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// errTravailInconnu est renvoyée quand on demande un travail qui n'existe pas (ou plus)
+var errTravailInconnu = errors.New("travail inconnu ou expiré")
+
+// travail est une requête soumise de manière asynchrone : elle attend dans la file puis est traitée par un des workers,
+// et son résultat est conservé pour pouvoir être récupéré plus tard, éventuellement depuis une autre connexion
+type travail struct {
+	id      string
+	client  string
+	imgData shared.ImageData
+	log     *slog.Logger // Journal du travail : celui de la requête qui l'a soumis, avec l'identifiant du travail
+
+	// Les champs suivants sont protégés par le mutex de la file
+	etat      shared.JobState
+	reponse   shared.Response // Réponse à renvoyer une fois le travail terminé (image traitée ou erreur)
+	termineLe time.Time
+
+	fini chan struct{} // Fermé quand le travail est terminé, pour ceux qui attendent le résultat
+}
+
+// fileTravaux reçoit les travaux soumis et les fait traiter par un nombre limité de workers
+type fileTravaux struct {
+	mu                sync.Mutex
+	travaux           map[string]*travail // Tous les travaux connus (en attente, en cours ou terminés récemment)
+	attente           chan *travail       // Travaux pas encore commencés
+	dureeConservation time.Duration       // Durée pendant laquelle le résultat d'un travail terminé reste disponible
+
+	arret   context.Context // Annulé à l'arrêt du serveur : les workers ne commencent plus de nouveau travail
+	ctx     context.Context // Annulé à la fin du délai d'arrêt : les travaux en cours sont interrompus
+	workers sync.WaitGroup  // Terminé quand tous les workers se sont arrêtés
+}
+
+// travaux est la file partagée par toutes les connexions (gob et HTTP)
+var travaux *fileTravaux
+
+// nouvelleFileTravaux crée une file de travaux et démarre ses workers, qui s'arrêtent quand arret est annulé ;
+// ctx est le contexte du filtrage des travaux
+func nouvelleFileTravaux(arret, ctx context.Context, nbWorkers, capacite int, dureeConservation time.Duration) *fileTravaux {
+	f := &fileTravaux{
+		travaux:           make(map[string]*travail),
+		attente:           make(chan *travail, capacite),
+		dureeConservation: dureeConservation,
+		arret:             arret,
+		ctx:               ctx,
+	}
+	f.workers.Add(nbWorkers)
+	for i := 0; i < nbWorkers; i++ {
+		go f.worker()
+	}
+	go f.nettoyer()
+	return f
+}
+
+// soumettre ajoute un travail à la file et rend la main tout de suite, sans attendre son traitement ;
+// ctx est celui de la requête de soumission, dont le travail reprend le journal
+func (f *fileTravaux) soumettre(ctx context.Context, client string, imgData shared.ImageData) (*travail, error) {
+	// On refuse tout de suite une requête invalide ou une image aux dimensions trop grandes, plutôt que de faire échouer le travail plus tard
+	if err := verifierRequete(imgData); err != nil {
+		return nil, err
+	}
+	id, err := identifiantTravail()
+	if err != nil {
+		return nil, err
+	}
+	t := &travail{id: id, client: client, imgData: imgData, etat: shared.JobPending, fini: make(chan struct{})}
+	t.log = filters.Logger(ctx).With("travail", id)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.arret.Err() != nil {
+		return nil, errArret
+	}
+	select {
+	case f.attente <- t:
+		f.travaux[id] = t
+		return t, nil
+	default:
+		return nil, &erreurOccupe{raison: "file des travaux pleine", retryAfter: admission.delaiConseille()}
+	}
+}
+
+// trouver renvoie le travail correspondant à un identifiant ; quand l'authentification est active,
+// un client ne peut consulter que ses propres travaux
+func (f *fileTravaux) trouver(id, client string) (*travail, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.travaux[id]
+	if !ok || (jetons != nil && t.client != client) {
+		return nil, fmt.Errorf("%w : %q", errTravailInconnu, id)
+	}
+	return t, nil
+}
+
+// etat renvoie l'état actuel d'un travail et, s'il est terminé, la réponse à renvoyer au client
+func (f *fileTravaux) etat(t *travail) (shared.JobState, shared.Response) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return t.etat, t.reponse
+}
+
+// worker traite les travaux de la file les uns après les autres, jusqu'à l'arrêt du serveur
+func (f *fileTravaux) worker() {
+	defer f.workers.Done()
+	for {
+		select {
+		case <-f.arret.Done():
+			return
+		case t := <-f.attente:
+			f.traiter(t)
+		}
+	}
+}
+
+// traiter exécute un travail dès que le contrôle d'admission le permet, et range son résultat
+func (f *fileTravaux) traiter(t *travail) {
+	// Comme pour les requêtes immédiates, le filtrage ne commence que quand le contrôle d'admission le permet
+	if err := admission.attendre(f.arret); err != nil {
+		f.terminer(t, reponseErreur(0, errArret))
+		return
+	}
+	debut := time.Now()
+	f.mu.Lock()
+	t.etat = shared.JobRunning
+	f.mu.Unlock()
+	t.log.Debug("Début du travail", "image", t.imgData.Name)
+
+	reponse := executerTravail(f.ctx, t)
+	admission.sortir(debut)
+	f.terminer(t, reponse)
+}
+
+// terminer range la réponse d'un travail et prévient ceux qui attendent son résultat
+func (f *fileTravaux) terminer(t *travail, reponse shared.Response) {
+	f.mu.Lock()
+	t.etat = shared.JobDone
+	if reponse.Status != shared.StatusOK {
+		t.etat = shared.JobFailed
+	}
+	t.reponse = reponse
+	t.termineLe = time.Now()
+	t.imgData = shared.ImageData{} // L'image d'origine n'est plus utile, on libère la mémoire
+	f.mu.Unlock()
+	close(t.fini)
+	t.log.Info("Travail terminé", "statut", reponse.Status)
+}
+
+// abandonner fait échouer les travaux qui n'ont pas encore commencé, à l'arrêt du serveur (après l'annulation de f.arret) :
+// les clients qui attendent leur résultat reçoivent l'erreur tout de suite, au lieu d'attendre un travail qui ne sera jamais fait
+func (f *fileTravaux) abandonner() int {
+	// La file est vidée sous le mutex : une soumission en cours y a déjà ajouté son travail, les suivantes sont refusées
+	var abandonnes []*travail
+	f.mu.Lock()
+	for vide := false; !vide; {
+		select {
+		case t := <-f.attente:
+			abandonnes = append(abandonnes, t)
+		default:
+			vide = true
+		}
+	}
+	f.mu.Unlock()
+
+	for _, t := range abandonnes {
+		f.terminer(t, reponseErreur(0, errArret))
+	}
+	return len(abandonnes)
+}
+
+// executerTravail applique les filtres d'un travail
+func executerTravail(ctx context.Context, t *travail) shared.Response {
+	processedImgData, err := traiterRequete(filters.WithLogger(ctx, t.log), t.imgData)
+	if err != nil {
+		t.log.Log(ctx, niveauEchec(err), "Échec du travail", "erreur", err)
+		return reponseErreur(0, err)
+	}
+	return shared.Response{Status: shared.StatusOK, Image: processedImgData}
+}
+
+// nettoyer supprime régulièrement les travaux terminés depuis plus de f.dureeConservation
+func (f *fileTravaux) nettoyer() {
+	for range time.Tick(time.Minute) {
+		f.mu.Lock()
+		for id, t := range f.travaux {
+			if !t.termineLe.IsZero() && time.Since(t.termineLe) > f.dureeConservation {
+				delete(f.travaux, id)
+			}
+		}
+		f.mu.Unlock()
+	}
+}
+
+// reponseTravail construit la réponse décrivant un travail : son résultat s'il est terminé, sinon son état (StatusAccepted)
+func reponseTravail(requestID uint64, t *travail) shared.Response {
+	etat, reponse := travaux.etat(t)
+	if etat == shared.JobPending || etat == shared.JobRunning {
+		reponse = shared.Response{Status: shared.StatusAccepted}
+	}
+	reponse.RequestID = requestID
+	reponse.JobID = t.id
+	reponse.JobState = etat
+	return reponse
+}
+
+// reponseStatut construit la réponse décrivant seulement l'état d'un travail, sans son résultat
+// (avec le message d'erreur si le travail a échoué)
+func reponseStatut(requestID uint64, t *travail, status int) shared.Response {
+	etat, reponse := travaux.etat(t)
+	return shared.Response{RequestID: requestID, Status: status, JobID: t.id, JobState: etat, Message: reponse.Message}
+}
+
+// identifiantTravail génère un identifiant aléatoire, difficile à deviner pour un autre client
+func identifiantTravail() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("erreur lors de la génération de l'identifiant du travail : %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ecouterUnix crée la socket Unix du serveur et lui donne les permissions demandées.
+// Une socket laissée par un serveur arrêté brutalement est supprimée ; on refuse en revanche de remplacer
+// un fichier qui n'est pas une socket, ou une socket sur laquelle un autre serveur écoute encore.
+// La socket est supprimée à la fermeture du listener.
+func ecouterUnix(chemin string, permissions fs.FileMode) (net.Listener, error) {
+	if err := supprimerSocketObsolete(chemin); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", chemin)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(chemin, permissions); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("permissions de la socket %s : %w", chemin, err)
+	}
+	return ln, nil
+}
+
+// supprimerSocketObsolete supprime le fichier chemin s'il s'agit d'une socket sur laquelle plus personne n'écoute
+func supprimerSocketObsolete(chemin string) error {
+	info, err := os.Lstat(chemin)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s existe déjà et n'est pas une socket", chemin)
+	}
+
+	// Si la connexion réussit, un autre serveur utilise la socket : on ne la lui prend pas
+	conn, err := net.DialTimeout("unix", chemin, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("un autre serveur écoute déjà sur la socket %s", chemin)
+	}
+	journal.Info("Suppression de la socket obsolète", "chemin", chemin)
+	return os.Remove(chemin)
+}
+
+// permissions est un mode de fichier qui s'écrit en octal, comme "0660", dans le fichier de configuration et sur la ligne de commande
+type permissions fs.FileMode
+
+func (p permissions) String() string {
+	return fmt.Sprintf("%#o", uint32(p))
+}
+
+func (p *permissions) Set(s string) error {
+	v, err := strconv.ParseUint(strings.TrimPrefix(s, "0o"), 8, 32)
+	if err != nil || v > 0o777 {
+		return fmt.Errorf("permissions attendues en octal, comme 0660 : %q", s)
+	}
+	*p = permissions(v)
+	return nil
+}
+
+func (p *permissions) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("permissions attendues sous forme de texte, comme \"0660\" : %s", data)
+	}
+	return p.Set(s)
+}
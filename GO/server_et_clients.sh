@@ -8,7 +8,7 @@ if [ -z "$IMAGE" ] || [ ! -f "$IMAGE" ]; then
 fi
 
 #Démarrage du serveur en arrière plan
-go run server/server.go &
+go run ./server &
 SERVER_PID=$!
 
 #On attend que le serveur soit prêt
@@ -0,0 +1,246 @@
+package shared
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Noms des filtres proposés par le serveur
+const (
+	FilterGrayscale    = "gris"       // Niveaux de gris
+	FilterEdges        = "contours"   // Détection de contours
+	FilterSharpen      = "nettete"    // Netteté
+	FilterGaussianBlur = "flou"       // Flou gaussien
+	FilterBoxBlur      = "flou_boite" // Flou moyen : chaque pixel prend la moyenne des pixels du carré qui l'entoure
+	FilterCustomKernel = "noyau"      // Convolution par un noyau fourni par le client
+)
+
+// MaxKernelSize est la taille maximale (en nombre de lignes et de colonnes) d'un noyau personnalisé
+const MaxKernelSize = 25
+
+// Filter désigne un filtre par son nom, accompagné de ses paramètres
+type Filter struct {
+	Name   string             // Nom du filtre (FilterGrayscale, FilterEdges...)
+	Params map[string]float64 // Valeur des paramètres par nom, les paramètres absents prennent leur valeur par défaut
+	Kernel [][]float64        // Noyau de convolution carré de taille impaire, seulement pour FilterCustomKernel
+}
+
+// MaxPipelineLength est le nombre maximal de filtres qu'on peut enchaîner dans une requête
+const MaxPipelineLength = 16
+
+// Pipeline est une suite ordonnée de filtres, appliqués l'un après l'autre sur la même image
+type Pipeline []Filter
+
+// ParamSpec décrit un paramètre accepté par un filtre : son type (entier ou réel), ses bornes et sa valeur par défaut
+type ParamSpec struct {
+	Name        string
+	Description string
+	Min, Max    float64
+	Default     float64
+	Integer     bool
+}
+
+// FilterParams associe à chaque filtre la liste des paramètres qu'il accepte
+var FilterParams = map[string][]ParamSpec{
+	FilterGrayscale: nil,
+	FilterEdges: {
+		{Name: "seuil", Description: "intensité minimale d'un contour, les pixels plus sombres sont mis à noir", Min: 0, Max: 255, Default: 0},
+	},
+	FilterSharpen: {
+		{Name: "intensite", Description: "force du renforcement de la netteté", Min: 0, Max: 10, Default: 1},
+	},
+	FilterGaussianBlur: {
+		{Name: "rayon", Description: "rayon du noyau en pixels", Min: 1, Max: 50, Default: 1, Integer: true},
+		{Name: "sigma", Description: "écart-type de la gaussienne, 0 pour le déduire du rayon", Min: 0, Max: 100, Default: 0},
+	},
+	FilterBoxBlur: {
+		{Name: "rayon", Description: "demi-côté du carré moyenné en pixels", Min: 1, Max: 100, Default: 1, Integer: true},
+	},
+	FilterCustomKernel: {
+		{Name: "diviseur", Description: "diviseur appliqué à la somme pondérée, 0 pour utiliser la somme des coefficients", Min: -1e6, Max: 1e6, Default: 0},
+		{Name: "biais", Description: "valeur ajoutée à chaque canal après la division", Min: -255, Max: 255, Default: 0},
+	},
+}
+
+// legacyFilters fait correspondre les anciens numéros de filtre (ImageData.FilterType) aux noms actuels
+var legacyFilters = map[int]string{
+	1: FilterGrayscale,
+	2: FilterEdges,
+	3: FilterSharpen,
+	4: FilterGaussianBlur,
+}
+
+// FilterFromType convertit un ancien numéro de filtre (1 à 4) en Filter, sans paramètre
+// un numéro inconnu donne un filtre sans nom, que le serveur refusera
+func FilterFromType(filterType int) Filter {
+	return Filter{Name: legacyFilters[filterType]}
+}
+
+// FilterNames renvoie la liste triée des noms de filtres
+func FilterNames() []string {
+	names := make([]string, 0, len(FilterParams))
+	for name := range FilterParams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseFilter lit un filtre écrit sous la forme "nom" ou "nom:param=valeur,param=valeur"
+// (par exemple "flou:rayon=3,sigma=1.5"). Un numéro entre 1 et 4 est aussi accepté pour rester compatible avec les anciens clients.
+// Un noyau personnalisé s'écrit entre crochets juste après le nom, lignes séparées par des "/" et valeurs par des ","
+// (par exemple "noyau[0,-1,0/-1,5,-1/0,-1,0]:biais=10").
+// Seule la syntaxe est vérifiée ici : le serveur se charge de valider le nom du filtre et ses paramètres.
+func ParseFilter(spec string) (Filter, error) {
+	spec = strings.TrimSpace(spec)
+	if n, err := strconv.Atoi(spec); err == nil {
+		filter := FilterFromType(n)
+		if filter.Name == "" {
+			return Filter{}, fmt.Errorf("numéro de filtre inconnu : %d", n)
+		}
+		return filter, nil
+	}
+
+	var kernel [][]float64
+	if open := strings.Index(spec, "["); open >= 0 {
+		end := strings.Index(spec, "]")
+		if end < open {
+			return Filter{}, fmt.Errorf("crochet fermant manquant dans %q", spec)
+		}
+		var err error
+		if kernel, err = ParseKernel(spec[open+1 : end]); err != nil {
+			return Filter{}, err
+		}
+		spec = spec[:open] + spec[end+1:]
+	}
+
+	name, params, _ := strings.Cut(spec, ":")
+	if name == "" {
+		return Filter{}, fmt.Errorf("nom de filtre manquant dans %q", spec)
+	}
+	filter := Filter{Name: strings.ToLower(name), Kernel: kernel}
+	if params == "" {
+		return filter, nil
+	}
+
+	filter.Params = make(map[string]float64)
+	for _, param := range strings.Split(params, ",") {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok || key == "" {
+			return Filter{}, fmt.Errorf("paramètre mal formé %q (attendu : nom=valeur)", param)
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return Filter{}, fmt.Errorf("valeur invalide pour le paramètre %q : %q", key, value)
+		}
+		filter.Params[strings.ToLower(key)] = v
+	}
+	return filter, nil
+}
+
+// ParseKernel lit un noyau dont les lignes sont séparées par des "/" et les valeurs par des "," (ou des espaces)
+// la forme du noyau (carré, de taille impaire) n'est pas vérifiée ici, c'est le rôle du serveur
+func ParseKernel(spec string) ([][]float64, error) {
+	var kernel [][]float64
+	for _, line := range strings.Split(spec, "/") {
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' })
+		row := make([]float64, len(fields))
+		for i, field := range fields {
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("valeur de noyau invalide : %q", field)
+			}
+			row[i] = v
+		}
+		kernel = append(kernel, row)
+	}
+	return kernel, nil
+}
+
+// ParsePipeline lit une suite de filtres séparés par des "+", chacun écrit comme pour ParseFilter
+// (par exemple "gris+flou:rayon=3+contours"). Le signe d'un nombre ne sépare pas deux filtres : "biais=+10", "sigma=1e+1"
+// et les valeurs d'un noyau entre crochets restent dans leur filtre
+func ParsePipeline(spec string) (Pipeline, error) {
+	var pipeline Pipeline
+	for _, step := range splitPipeline(spec) {
+		filter, err := ParseFilter(step)
+		if err != nil {
+			return nil, err
+		}
+		pipeline = append(pipeline, filter)
+	}
+	return pipeline, nil
+}
+
+// splitPipeline découpe un pipeline en filtres, sur les "+" qui ne sont ni entre crochets, ni le signe d'un nombre
+// (juste après un "=", ou l'exposant d'un nombre comme 1e+1)
+func splitPipeline(spec string) []string {
+	var steps []string
+	depth, start := 0, 0
+	for i := 0; i < len(spec); i++ {
+		switch spec[i] {
+		case '[':
+			depth++
+		case ']':
+			if depth > 0 {
+				depth--
+			}
+		case '+':
+			if depth > 0 || (i > 0 && spec[i-1] == '=') || isExponent(spec, i-1) {
+				continue
+			}
+			steps = append(steps, spec[start:i])
+			start = i + 1
+		}
+	}
+	return append(steps, spec[start:])
+}
+
+// isExponent indique si spec[i] est le "e" de l'exposant d'un nombre (précédé d'un chiffre ou d'un point)
+func isExponent(spec string, i int) bool {
+	if i < 1 || (spec[i] != 'e' && spec[i] != 'E') {
+		return false
+	}
+	c := spec[i-1]
+	return c == '.' || (c >= '0' && c <= '9')
+}
+
+// String écrit le pipeline dans la syntaxe acceptée par ParsePipeline
+func (p Pipeline) String() string {
+	steps := make([]string, len(p))
+	for i, filter := range p {
+		steps[i] = filter.String()
+	}
+	return strings.Join(steps, "+")
+}
+
+// String écrit le filtre dans la syntaxe acceptée par ParseFilter
+func (f Filter) String() string {
+	name := f.Name
+	if f.Kernel != nil {
+		rows := make([]string, len(f.Kernel))
+		for i, row := range f.Kernel {
+			values := make([]string, len(row))
+			for j, v := range row {
+				values[j] = strconv.FormatFloat(v, 'g', -1, 64)
+			}
+			rows[i] = strings.Join(values, ",")
+		}
+		name += "[" + strings.Join(rows, "/") + "]"
+	}
+	if len(f.Params) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(f.Params))
+	for key := range f.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := make([]string, len(keys))
+	for i, key := range keys {
+		params[i] = key + "=" + strconv.FormatFloat(f.Params[key], 'g', -1, 64)
+	}
+	return name + ":" + strings.Join(params, ",")
+}
@@ -0,0 +1,71 @@
+package shared
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// UnixScheme précède le chemin d'une socket Unix dans une adresse de serveur, par exemple unix:///run/filtres.sock
+const UnixScheme = "unix://"
+
+// SplitAddress renvoie le réseau ("unix" ou "tcp") et l'adresse à utiliser avec net.Dial ou net.Listen :
+// une adresse qui commence par unix:// désigne le chemin d'une socket Unix, les autres sont de la forme hôte:port
+func SplitAddress(address string) (network, addr string) {
+	if path, ok := strings.CutPrefix(address, UnixScheme); ok {
+		return "unix", path
+	}
+	return "tcp", address
+}
+
+// Dial se connecte au serveur, en TCP (hôte:port) ou par une socket Unix (unix:///chemin).
+// Si tlsConfig n'est pas nil, la connexion TCP est chiffrée avec TLS (voir ClientTLSConfig)
+func Dial(address string, tlsConfig *tls.Config) (net.Conn, error) {
+	network, addr := SplitAddress(address)
+	if tlsConfig == nil {
+		return net.Dial(network, addr)
+	}
+	if network == "unix" {
+		return nil, errors.New("TLS n'est pas utilisé sur une socket Unix")
+	}
+	return tls.Dial(network, addr, tlsConfig)
+}
+
+// ClientTLSConfig prépare la configuration TLS d'un client. Le certificat du serveur est vérifié avec les autorités
+// de caFile (un ou plusieurs certificats PEM), ou celles du système si caFile est vide. Si certFile et keyFile sont
+// donnés, le client présente ce certificat au serveur, pour les serveurs qui vérifient les certificats des clients.
+func ClientTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pool, err := LoadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("certificat du client : %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// LoadCertPool lit un fichier PEM contenant un ou plusieurs certificats d'autorités de certification
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("autorités de certification : %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("autorités de certification : aucun certificat PEM dans %s", file)
+	}
+	return pool, nil
+}
@@ -1,7 +1,148 @@
 package shared
 
 type ImageData struct {
-	Name       string // Nom de l'image
-	Data       []byte // Données binaires de l'image
-	FilterType int    // Type de filtre à appliquer
+	Name         string   // Nom de l'image
+	Data         []byte   // Données binaires de l'image
+	FilterType   int      // Type de filtre à appliquer (ancien protocole, utilisé seulement si Filter.Name est vide)
+	Filter       Filter   // Filtre à appliquer, désigné par son nom avec ses paramètres
+	Pipeline     Pipeline // Filtres à appliquer successivement sur l'image (prioritaire sur Filter et FilterType s'il n'est pas vide)
+	RequestID    uint64   // Identifiant de la requête dans la session, renvoyé tel quel dans la réponse
+	Close        bool     // Message de fin de session : le serveur ferme alors la connexion (les autres champs sont ignorés)
+	Action       Action   // Ce que le client demande au serveur (ActionProcess si vide)
+	JobID        string   // Identifiant du travail concerné, pour ActionStatus et ActionFetch
+	Wait         bool     // Pour ActionFetch : attendre la fin du travail au lieu de répondre tout de suite
+	OutputFormat string   // Format de l'image traitée (FormatJPEG, FormatPNG ou FormatGIF), le même que l'image reçue si vide
+	Strategy     Strategy // Répartition du calcul des convolutions entre les goroutines du serveur, celle du serveur si vide
 }
+
+// Authentication est le premier message de chaque session, envoyé par le client avant toute image :
+// le serveur y répond par une Response (StatusOK, ou CategoryUnauthorized s'il refuse le client et ferme la connexion)
+type Authentication struct {
+	Token string // Jeton d'accès attribué au client (ignoré si le serveur n'exige pas d'authentification)
+}
+
+// Action indique ce qu'un client demande au serveur dans un ImageData
+type Action string
+
+const (
+	ActionProcess Action = ""          // Traiter l'image tout de suite et renvoyer le résultat dans la réponse
+	ActionSubmit  Action = "soumettre" // Mettre l'image dans la file des travaux, la réponse contient l'identifiant du travail
+	ActionStatus  Action = "statut"    // Connaître l'état d'un travail soumis auparavant
+	ActionFetch   Action = "recuperer" // Récupérer le résultat d'un travail (éventuellement en attendant qu'il se termine)
+)
+
+// Strategy désigne la manière dont le serveur répartit le calcul des convolutions entre ses goroutines
+type Strategy string
+
+const (
+	StrategyDefault    Strategy = ""             // Celle choisie dans la configuration du serveur
+	StrategySequential Strategy = "sequentielle" // Toute l'image dans une seule goroutine
+	StrategyRows       Strategy = "lignes"       // Une bande de lignes par goroutine de calcul
+	StrategyTiles      Strategy = "tuiles"       // Des tuiles de 128x128 pixels réparties entre les goroutines de calcul
+	StrategyCompare    Strategy = "comparaison"  // Séquentielle puis en tuiles, pour comparer les temps d'exécution
+)
+
+// Strategies est la liste des stratégies d'exécution qu'on peut demander au serveur
+var Strategies = []Strategy{StrategySequential, StrategyRows, StrategyTiles, StrategyCompare}
+
+// JobState est l'état d'un travail soumis au serveur
+type JobState string
+
+const (
+	JobPending JobState = "en_attente" // dans la file, pas encore commencé
+	JobRunning JobState = "en_cours"   // en cours de traitement
+	JobDone    JobState = "termine"    // terminé avec succès, le résultat peut être récupéré
+	JobFailed  JobState = "echec"      // terminé en erreur, la réponse en donne la raison
+)
+
+// Codes de statut d'une réponse, repris des codes HTTP équivalents
+const (
+	StatusOK                   = 200
+	StatusAccepted             = 202
+	StatusBadRequest           = 400
+	StatusUnauthorized         = 401
+	StatusNotFound             = 404
+	StatusPayloadTooLarge      = 413
+	StatusUnsupportedMediaType = 415
+	StatusUnprocessable        = 422
+	StatusTooManyRequests      = 429
+	StatusInternalError        = 500
+	StatusServiceUnavailable   = 503
+	StatusGatewayTimeout       = 504
+)
+
+// ErrorCategory indique la nature d'une erreur renvoyée par le serveur
+type ErrorCategory string
+
+const (
+	CategoryNone              ErrorCategory = ""
+	CategoryBadRequest        ErrorCategory = "requete_invalide"    // requête mal formée
+	CategoryUnknownFilter     ErrorCategory = "filtre_inconnu"      // filtre demandé inexistant
+	CategoryInvalidParameter  ErrorCategory = "parametre_invalide"  // paramètre de filtre inconnu ou hors limites
+	CategoryInvalidImage      ErrorCategory = "image_invalide"      // image impossible à décoder
+	CategoryUnsupportedFormat ErrorCategory = "format_non_supporte" // format d'image non pris en charge
+	CategoryInternal          ErrorCategory = "erreur_interne"      // erreur côté serveur
+	CategoryUnknownJob        ErrorCategory = "travail_inconnu"     // identifiant de travail inconnu ou expiré
+	CategoryBusy              ErrorCategory = "serveur_occupe"      // le serveur ne peut pas accepter de travail pour le moment
+	CategoryUnauthorized      ErrorCategory = "non_authentifie"     // jeton d'accès absent ou inconnu
+	CategoryRateLimited       ErrorCategory = "limite_depassee"     // le client a dépassé son débit autorisé ou son quota du jour
+	CategoryTooLarge          ErrorCategory = "trop_volumineux"     // message trop long ou image aux dimensions trop grandes
+	CategoryTimeout           ErrorCategory = "delai_depasse"       // la requête n'a pas pu être traitée dans le délai autorisé
+)
+
+// ExitCode renvoie le code de sortie qu'un client doit utiliser pour une erreur de cette catégorie
+// (0 si pas d'erreur ; 1 n'est attribué à aucune catégorie et reste disponible pour les erreurs locales)
+func (c ErrorCategory) ExitCode() int {
+	switch c {
+	case CategoryNone:
+		return 0
+	case CategoryBadRequest:
+		return 2
+	case CategoryUnknownFilter:
+		return 3
+	case CategoryInvalidImage:
+		return 4
+	case CategoryUnsupportedFormat:
+		return 5
+	case CategoryInvalidParameter:
+		return 7
+	case CategoryUnknownJob:
+		return 8
+	case CategoryBusy:
+		return 9
+	case CategoryUnauthorized:
+		return 10
+	case CategoryRateLimited:
+		return 11
+	case CategoryTooLarge:
+		return 12
+	case CategoryTimeout:
+		return 13
+	default:
+		return 6
+	}
+}
+
+// Response est l'enveloppe renvoyée par le serveur pour chaque requête :
+// en cas de succès Status vaut StatusOK et Image contient l'image traitée, sinon Category et Message décrivent l'erreur.
+// Pour un travail soumis ou pas encore terminé, Status vaut StatusAccepted et JobID/JobState décrivent le travail.
+type Response struct {
+	RequestID  uint64        // Identifiant de la requête à laquelle on répond
+	Status     int           // Code de statut (StatusOK si tout s'est bien passé)
+	Category   ErrorCategory // Catégorie de l'erreur (CategoryNone en cas de succès)
+	Message    string        // Message d'erreur lisible par l'utilisateur
+	Image      ImageData     // Image traitée (vide en cas d'erreur)
+	JobID      string        // Identifiant du travail concerné (requêtes asynchrones)
+	JobState   JobState      // État du travail concerné (requêtes asynchrones)
+	RetryAfter int           // Pour CategoryBusy et CategoryRateLimited : nombre de secondes conseillé avant de réessayer
+}
+
+// Formats d'image acceptés par le serveur, en entrée comme en sortie (noms utilisés par le package image)
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatGIF  = "gif"
+)
+
+// ImageFormats liste les formats d'image acceptés
+var ImageFormats = []string{FormatJPEG, FormatPNG, FormatGIF}